@@ -369,7 +369,7 @@ func (s *Server) toLocalizedNotifications(ctx context.Context, log *zap.Logger,
 
 			var userOutcome poolpb.UserOutcome
 			var nativeAmount float64
-			userPoolSummary, err := pool.GetUserSummary(ctx, s.pools, s.codeData, userID, bettingPool)
+			userPoolSummary, err := pool.GetUserSummary(ctx, s.pools, userID, bettingPool)
 			if err != nil {
 				return nil, err
 			}
@@ -0,0 +1,5 @@
+-- AlterTable
+ALTER TABLE "flipcash_pools" ADD COLUMN     "isRefundOwed" BOOLEAN NOT NULL DEFAULT false;
+
+-- CreateIndex
+CREATE INDEX "flipcash_pools_isOpen_resolution_isRefundOwed_closedAt_idx" ON "flipcash_pools"("isOpen", "resolution", "isRefundOwed", "closedAt");
@@ -0,0 +1,24 @@
+-- CreateTable
+CREATE TABLE "flipcash_paidbetcounts" (
+    "poolId" TEXT NOT NULL,
+    "outcome" INTEGER NOT NULL,
+    "numPaidBets" INTEGER NOT NULL DEFAULT 0,
+    "createdAt" TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "updatedAt" TIMESTAMP(3) NOT NULL,
+
+    CONSTRAINT "flipcash_paidbetcounts_pkey" PRIMARY KEY ("poolId","outcome")
+);
+
+-- CreateIndex
+CREATE INDEX "flipcash_pools_resolution_id_idx" ON "flipcash_pools"("resolution", "id");
+
+-- Backfill paid bet counts for existing pools
+INSERT INTO "flipcash_paidbetcounts" ("poolId", "outcome", "numPaidBets", "updatedAt")
+SELECT b."poolId",
+    CASE WHEN b."selectedOutcome" THEN 0 ELSE 1 END,
+    COUNT(*),
+    CURRENT_TIMESTAMP
+FROM "flipcash_bets" b
+JOIN "flipcash_pools" p ON p."id" = b."poolId"
+WHERE b."isIntentSubmitted" = true
+GROUP BY 1, 2;
@@ -0,0 +1,2 @@
+-- CreateIndex
+CREATE INDEX "flipcash_bets_isIntentSubmitted_id_idx" ON "flipcash_bets"("isIntentSubmitted", "id");
@@ -0,0 +1,16 @@
+-- CreateTable
+CREATE TABLE "flipcash_inboxevents" (
+    "id" BIGSERIAL NOT NULL,
+    "key" TEXT NOT NULL,
+    "event" TEXT NOT NULL,
+    "createdAt" TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "expiresAt" TIMESTAMP(3) NOT NULL,
+
+    CONSTRAINT "flipcash_inboxevents_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateIndex
+CREATE INDEX "flipcash_inboxevents_key_id_idx" ON "flipcash_inboxevents"("key", "id");
+
+-- CreateIndex
+CREATE INDEX "flipcash_inboxevents_expiresAt_idx" ON "flipcash_inboxevents"("expiresAt");
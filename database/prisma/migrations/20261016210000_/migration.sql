@@ -0,0 +1,4 @@
+-- AlterTable
+ALTER TABLE "flipcash_rendezvous" DROP CONSTRAINT "flipcash_rendezvous_pkey",
+ADD COLUMN     "appInstallId" TEXT NOT NULL DEFAULT '',
+ADD CONSTRAINT "flipcash_rendezvous_pkey" PRIMARY KEY ("key", "appInstallId");
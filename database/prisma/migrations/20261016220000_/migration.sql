@@ -0,0 +1,10 @@
+-- CreateTable
+CREATE TABLE "flipcash_inboxcursors" (
+    "key" TEXT NOT NULL,
+    "appInstallId" TEXT NOT NULL DEFAULT '',
+    "sequence" BIGINT NOT NULL,
+    "createdAt" TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "updatedAt" TIMESTAMP(3) NOT NULL,
+
+    CONSTRAINT "flipcash_inboxcursors_pkey" PRIMARY KEY ("key","appInstallId")
+);
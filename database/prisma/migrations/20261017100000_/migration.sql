@@ -0,0 +1,2 @@
+-- CreateIndex
+CREATE INDEX "flipcash_inboxcursors_updatedAt_idx" ON "flipcash_inboxcursors"("updatedAt");
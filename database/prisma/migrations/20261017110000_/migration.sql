@@ -0,0 +1,2 @@
+-- AlterTable
+ALTER TABLE "flipcash_bets" ADD COLUMN     "reconcileLeaseExpiresAt" TIMESTAMP(3);
@@ -0,0 +1,97 @@
+package event
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type StreamBackendType string
+
+const (
+	// StreamBackendRendezvous tracks where streams are hosted with rendezvous
+	// records, and forwards events between servers over RPC
+	StreamBackendRendezvous StreamBackendType = "rendezvous"
+
+	// StreamBackendPostgresNotify publishes events over Postgres LISTEN/NOTIFY,
+	// and every server delivers to the streams it hosts
+	StreamBackendPostgresNotify StreamBackendType = "postgres_notify"
+)
+
+// StreamBackend routes events to the servers hosting users' streams, and is
+// told as streams open and close on this server
+type StreamBackend interface {
+	Forwarder
+
+	// RegisterStream is called when an app install's stream opens on this
+	// server. ErrRendezvousExists is returned when the app install is streaming
+	// from another server.
+	RegisterStream(ctx context.Context, key, appInstallID string) error
+
+	// RefreshStream is called periodically while the stream is open.
+	// ErrRendezvousNotFound is returned when another server took over the
+	// app install's stream.
+	RefreshStream(ctx context.Context, key, appInstallID string) error
+
+	// UnregisterStream is called when the stream closes
+	UnregisterStream(ctx context.Context, key, appInstallID string) error
+}
+
+// LocalStreams delivers events to the streams hosted by a server
+type LocalStreams interface {
+	Transport
+
+	// DeliverInboxEvent delivers an event that's already in the user's inbox to
+	// the user's streams hosted by the server. The app installs it was delivered
+	// to are returned, so their inbox cursors can be moved past it.
+	DeliverInboxEvent(ctx context.Context, inboxEvent *InboxEvent) (appInstallIDs []string, err error)
+}
+
+// StreamBackendCtor creates the stream backend for a server, which delivers
+// events to the streams hosted by the server
+type StreamBackendCtor func(local LocalStreams) StreamBackend
+
+type rendezvousBackend struct {
+	*BatchingForwarder
+
+	events Store
+
+	broadcastAddress string
+}
+
+// NewRendezvousBackend creates a stream backend that keeps a rendezvous record
+// for each stream, and forwards events to other servers over RPC
+func NewRendezvousBackend(log *zap.Logger, events Store, broadcastAddress, currentRpcApiKey string, config ForwarderConfig) StreamBackendCtor {
+	return func(local LocalStreams) StreamBackend {
+		return &rendezvousBackend{
+			BatchingForwarder: NewBatchingForwarder(
+				log,
+				events,
+				NewRoutingTransport(broadcastAddress, local, NewRpcTransport(log, currentRpcApiKey)),
+				config,
+			),
+
+			events: events,
+
+			broadcastAddress: broadcastAddress,
+		}
+	}
+}
+
+func (b *rendezvousBackend) RegisterStream(ctx context.Context, key, appInstallID string) error {
+	return b.events.CreateRendezvous(ctx, &Rendezvous{
+		Key:          key,
+		AppInstallID: appInstallID,
+		Address:      b.broadcastAddress,
+		ExpiresAt:    time.Now().Add(rendezvousExpiryTime),
+	})
+}
+
+func (b *rendezvousBackend) RefreshStream(ctx context.Context, key, appInstallID string) error {
+	return b.events.ExtendRendezvousExpiry(ctx, key, appInstallID, b.broadcastAddress, time.Now().Add(rendezvousExpiryTime))
+}
+
+func (b *rendezvousBackend) UnregisterStream(ctx context.Context, key, appInstallID string) error {
+	return b.events.DeleteRendezvous(ctx, key, appInstallID, b.broadcastAddress)
+}
@@ -2,14 +2,13 @@ package event
 
 import (
 	"context"
+	"sync"
 	"time"
 
-	"github.com/pkg/errors"
 	"go.uber.org/zap"
 
 	eventpb "github.com/code-payments/flipcash-protobuf-api/generated/go/event/v1"
 
-	codeheaders "github.com/code-payments/code-server/pkg/grpc/headers"
 	coderetry "github.com/code-payments/code-server/pkg/retry"
 	codebackoff "github.com/code-payments/code-server/pkg/retry/backoff"
 	"github.com/code-payments/flipcash-server/model"
@@ -19,108 +18,332 @@ type Forwarder interface {
 	ForwardUserEvents(ctx context.Context, events ...*eventpb.UserEvent) error
 }
 
-type ForwardingClient struct {
+// ForwarderMetrics observes forwarding outcomes. Hooks are called from the
+// forwarder's goroutines, so implementations must be safe for concurrent use.
+type ForwarderMetrics interface {
+	// OnEventsDelivered is called when a batch is delivered to a receiver address
+	OnEventsDelivered(address string, numEvents int, latency time.Duration)
+
+	// OnDeliveryFailed is called when a batch can't be delivered to a receiver
+	// address after retries
+	OnDeliveryFailed(address string, numEvents int, err error)
+
+	// OnEventsInboxed is called when events are added to inboxes, which every
+	// event is before it's delivered
+	OnEventsInboxed(numEvents int)
+}
+
+type noOpForwarderMetrics struct{}
+
+func NewNoOpForwarderMetrics() ForwarderMetrics {
+	return &noOpForwarderMetrics{}
+}
+
+func (m *noOpForwarderMetrics) OnEventsDelivered(_ string, _ int, _ time.Duration) {}
+
+func (m *noOpForwarderMetrics) OnDeliveryFailed(_ string, _ int, _ error) {}
+
+func (m *noOpForwarderMetrics) OnEventsInboxed(_ int) {}
+
+type ForwarderConfig struct {
+	// BatchWindow is how long events are coalesced before being forwarded
+	BatchWindow time.Duration
+
+	// RetryStrategies apply to adding events to inboxes, rendezvous lookups and
+	// batch deliveries
+	RetryStrategies []coderetry.Strategy
+
+	// MaxQueuedEvents caps the events waiting for the next flush, and the events
+	// waiting to be delivered to each receiver address. Events beyond the cap
+	// are only added to their users' inboxes.
+	MaxQueuedEvents int
+
+	Metrics ForwarderMetrics
+}
+
+var DefaultForwarderConfig = ForwarderConfig{
+	BatchWindow: 10 * time.Millisecond,
+	RetryStrategies: []coderetry.Strategy{
+		coderetry.Limit(3),
+		coderetry.Backoff(codebackoff.BinaryExponential(100*time.Millisecond), 500*time.Millisecond),
+	},
+	MaxQueuedEvents: 16 * maxEventBatchSize,
+	Metrics:         NewNoOpForwarderMetrics(),
+}
+
+// BatchingForwarder coalesces user events over a short window, adds them to
+// their users' inboxes, looks up their rendezvous records in bulk, and queues
+// them for delivery over a transport by receiver address. Flushes are
+// serialized and each address is delivered to in queue order, so per-user
+// ordering is kept across windows. Deliveries, and their retries, happen outside
+// of flushes, so a failing address only delays its own events. Live delivery is
+// an optimization: receivers move the inbox cursors of the app installs that got
+// an event past it, and every other app install replays it from the inbox.
+type BatchingForwarder struct {
 	log *zap.Logger
 
 	events Store
 
-	currentRpcApiKey string
+	transport Transport
+
+	config ForwarderConfig
+
+	mu          sync.Mutex
+	pending     []*eventpb.UserEvent
+	isScheduled bool
+
+	flushMu sync.Mutex
+
+	queuesMu sync.Mutex
+	queues   map[string]*addressQueue
 }
 
-func NewForwardingClient(log *zap.Logger, events Store, currentRpcApiKey string) Forwarder {
-	return &ForwardingClient{
+// addressQueue holds the events waiting to be delivered to a receiver address
+type addressQueue struct {
+	events       []*ForwardedEvent
+	isDelivering bool
+}
+
+func NewBatchingForwarder(log *zap.Logger, events Store, transport Transport, config ForwarderConfig) *BatchingForwarder {
+	if config.Metrics == nil {
+		config.Metrics = NewNoOpForwarderMetrics()
+	}
+	if config.MaxQueuedEvents <= 0 {
+		config.MaxQueuedEvents = DefaultForwarderConfig.MaxQueuedEvents
+	}
+
+	return &BatchingForwarder{
 		log: log,
 
 		events: events,
 
-		currentRpcApiKey: currentRpcApiKey,
+		transport: transport,
+
+		config: config,
+
+		queues: make(map[string]*addressQueue),
 	}
 }
 
-// todo: duplicated code with ForwardingClient
-func (c *ForwardingClient) ForwardUserEvents(ctx context.Context, events ...*eventpb.UserEvent) error {
-	var err error
-	if !codeheaders.AreHeadersInitialized(ctx) {
-		ctx, err = codeheaders.ContextWithHeaders(ctx)
-		if err != nil {
-			c.log.With(zap.Error(err)).Warn("Failure initializing headers")
-			return err
-		}
+// NewForwardingClient creates a forwarder for processes that don't host event
+// streams, which forwards every event to its receiver over RPC
+func NewForwardingClient(log *zap.Logger, events Store, currentRpcApiKey string, config ForwarderConfig) Forwarder {
+	return NewBatchingForwarder(log, events, NewRpcTransport(log, currentRpcApiKey), config)
+}
+
+// ForwardUserEvents queues user events to be forwarded in the next flush.
+// Events that don't fit in the queue are only added to their users' inboxes.
+func (f *BatchingForwarder) ForwardUserEvents(ctx context.Context, events ...*eventpb.UserEvent) error {
+	if len(events) == 0 {
+		return nil
 	}
 
-	err = codeheaders.SetASCIIHeader(ctx, internalRpcApiKeyHeaderName, c.currentRpcApiKey)
-	if err != nil {
-		c.log.With(zap.Error(err)).Warn("Failure setting RPC API key header")
-		return err
+	f.mu.Lock()
+
+	numQueued := min(len(events), max(f.config.MaxQueuedEvents-len(f.pending), 0))
+	f.pending = append(f.pending, events[:numQueued]...)
+
+	if numQueued > 0 && !f.isScheduled {
+		f.isScheduled = true
+		time.AfterFunc(f.config.BatchWindow, f.flush)
 	}
 
-	for _, event := range events {
-		go func() {
-			coderetry.Retry(
-				func() error {
-					return c.forwardUserEvent(ctx, event)
-				},
-				coderetry.Limit(3),
-				coderetry.Backoff(codebackoff.BinaryExponential(100*time.Millisecond), 500*time.Millisecond),
-			)
-		}()
+	f.mu.Unlock()
+
+	overflow := events[numQueued:]
+	if len(overflow) > 0 {
+		f.log.With(zap.Int("num_events", len(overflow))).Warn("Pending event queue is full")
+		f.addToInbox(ctx, f.log, overflow)
 	}
+
 	return nil
 }
 
-// todo: duplicated code with ForwardingClient
-func (c *ForwardingClient) forwardUserEvent(ctx context.Context, event *eventpb.UserEvent) error {
-	log := c.log.With(
-		zap.String("event_id", EventIDString(event.Event.Id)),
-		zap.String("user_id", model.UserIDString(event.UserId)),
-	)
+func (f *BatchingForwarder) flush() {
+	f.flushMu.Lock()
+	defer f.flushMu.Unlock()
 
-	streamKey := model.UserIDString(event.UserId)
+	f.mu.Lock()
+	pending := f.pending
+	f.pending = nil
+	f.isScheduled = false
+	f.mu.Unlock()
 
-	rendezvous, err := c.events.GetRendezvous(ctx, streamKey)
-	switch err {
-	case nil:
-		log = log.With(zap.String("receiver_address", rendezvous.Address))
+	ctx := context.Background()
 
-		// Expired rendezvous record that likely wasn't cleaned up. Avoid forwarding,
-		// since we expect a broken state.
-		if time.Since(rendezvous.ExpiresAt) >= 0 {
-			log.With(zap.Error(err)).Debug("Dropping event with expired rendezvous record")
-			return nil
+	// Events are added to inboxes before they're delivered, so app installs that
+	// don't receive them live replay them when they next open a stream
+	forwarded := f.addToInbox(ctx, f.log, pending)
+
+	rendezvousByKey, err := f.getRendezvousByKey(ctx, forwarded)
+	if err != nil {
+		f.log.With(zap.Error(err)).Warn("Failure getting rendezvous records, leaving events in inboxes")
+		return
+	}
+
+	var addresses []string
+	eventsByAddress := make(map[string][]*ForwardedEvent)
+	for _, event := range forwarded {
+		// Fan out to every server hosting one of the user's app install streams.
+		// Each server delivers to all of the user's streams it hosts.
+		receiverAddresses := make(map[string]struct{})
+		for _, rendezvous := range rendezvousByKey[model.UserIDString(event.UserEvent.UserId)] {
+			// Expired rendezvous record that likely wasn't cleaned up. Avoid forwarding,
+			// since we expect a broken state.
+			if time.Since(rendezvous.ExpiresAt) >= 0 {
+				eventLogger(f.log, event.UserEvent).Debug("Not forwarding event with expired rendezvous record")
+				continue
+			}
+
+			if _, ok := receiverAddresses[rendezvous.Address]; ok {
+				continue
+			}
+			receiverAddresses[rendezvous.Address] = struct{}{}
+
+			if _, ok := eventsByAddress[rendezvous.Address]; !ok {
+				addresses = append(addresses, rendezvous.Address)
+			}
+			eventsByAddress[rendezvous.Address] = append(eventsByAddress[rendezvous.Address], event)
 		}
+	}
 
-		// Forward the event to the server hosting the user's stream
-		forwardingRpcClient, err := getForwardingRpcClient(rendezvous.Address)
+	for _, address := range addresses {
+		f.enqueue(ctx, address, eventsByAddress[address])
+	}
+}
+
+func (f *BatchingForwarder) getRendezvousByKey(ctx context.Context, events []*ForwardedEvent) (map[string][]*Rendezvous, error) {
+	var keys []string
+	seen := make(map[string]struct{})
+	for _, event := range events {
+		key := model.UserIDString(event.UserEvent.UserId)
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		keys = append(keys, key)
+	}
+
+	res := make(map[string][]*Rendezvous)
+	for start := 0; start < len(keys); start += maxEventBatchSize {
+		end := min(start+maxEventBatchSize, len(keys))
+
+		var batch []*Rendezvous
+		_, err := coderetry.Retry(
+			func() error {
+				var err error
+				batch, err = f.events.GetRendezvousBatch(ctx, keys[start:end]...)
+				return err
+			},
+			f.config.RetryStrategies...,
+		)
 		if err != nil {
-			log.With(zap.Error(err)).Warn("Failure creating forwarding RPC client")
-			return err
+			return nil, err
+		}
+
+		for _, rendezvous := range batch {
+			res[rendezvous.Key] = append(res[rendezvous.Key], rendezvous)
+		}
+	}
+	return res, nil
+}
+
+// enqueue adds events to the address's delivery queue, and starts delivering
+// to the address if it isn't already. Events that don't fit in the queue are
+// left in their users' inboxes.
+func (f *BatchingForwarder) enqueue(ctx context.Context, address string, events []*ForwardedEvent) {
+	f.queuesMu.Lock()
+
+	queue, ok := f.queues[address]
+	if !ok {
+		queue = &addressQueue{}
+		f.queues[address] = queue
+	}
+
+	numQueued := min(len(events), max(f.config.MaxQueuedEvents-len(queue.events), 0))
+	queue.events = append(queue.events, events[:numQueued]...)
+
+	if numQueued > 0 && !queue.isDelivering {
+		queue.isDelivering = true
+		go f.deliverToAddress(ctx, address)
+	}
+
+	f.queuesMu.Unlock()
+
+	overflow := events[numQueued:]
+	if len(overflow) > 0 {
+		log := f.log.With(zap.String("receiver_address", address))
+		log.With(zap.Int("num_events", len(overflow))).Warn("Delivery queue is full, leaving events in inboxes")
+	}
+}
+
+// deliverToAddress delivers the address's queued events in batches, until its
+// queue is empty
+func (f *BatchingForwarder) deliverToAddress(ctx context.Context, address string) {
+	log := f.log.With(zap.String("receiver_address", address))
+
+	for {
+		f.queuesMu.Lock()
+		queue := f.queues[address]
+		if len(queue.events) == 0 {
+			delete(f.queues, address)
+			f.queuesMu.Unlock()
+			return
 		}
+		end := min(maxEventBatchSize, len(queue.events))
+		batch := queue.events[:end]
+		queue.events = queue.events[end:]
+		f.queuesMu.Unlock()
 
-		ctx, cancel := context.WithTimeout(ctx, forwardRpcTimeout)
-		defer cancel()
+		var undelivered []*ForwardedEvent
+		_, err := coderetry.Retry(
+			func() error {
+				start := time.Now()
 
-		log.Debug("Forwarding events over RPC")
+				var err error
+				undelivered, err = f.transport.Deliver(ctx, address, batch)
+				if err != nil {
+					log.With(zap.Error(err)).Debug("Failure delivering events")
+					return err
+				}
 
-		resp, err := forwardingRpcClient.ForwardEvents(ctx, &eventpb.ForwardEventsRequest{
-			UserEvents: &eventpb.UserEventBatch{
-				Events: []*eventpb.UserEvent{event},
+				f.config.Metrics.OnEventsDelivered(address, len(batch)-len(undelivered), time.Since(start))
+				return nil
 			},
-		})
+			f.config.RetryStrategies...,
+		)
 		if err != nil {
-			log.With(zap.Error(err)).Warn("Failure forwarding event over RPC")
-			return err
-		} else if resp.Result != eventpb.ForwardEventsResponse_OK {
-			log.With(zap.String("result", resp.Result.String())).Warn("Failure forwarding event over RPC")
-			return errors.Errorf("rpc forward result %s", resp.Result)
+			log.With(zap.Error(err)).Warn("Failure delivering events, leaving them in inboxes")
+			f.config.Metrics.OnDeliveryFailed(address, len(batch), err)
 		}
+	}
+}
+
+// addToInbox adds events to their users' inboxes in batches, and returns the
+// events that were added, to be forwarded. Batches that can't be added are
+// dropped, since they'd be lost by any stream that doesn't receive them live.
+func (f *BatchingForwarder) addToInbox(ctx context.Context, log *zap.Logger, events []*eventpb.UserEvent) []*ForwardedEvent {
+	if len(events) == 0 {
+		return nil
+	}
 
-	case ErrRendezvousNotFound:
-		log.Debug("Dropping event without rendezvous record")
+	var forwarded []*ForwardedEvent
+	for start := 0; start < len(events); start += maxEventBatchSize {
+		end := min(start+maxEventBatchSize, len(events))
 
-	default:
-		log.With(zap.Error(err)).Warn("Failed to get rendezvous record")
-		return err
+		batch, err := addToInbox(ctx, log, f.events, events[start:end], f.config.RetryStrategies...)
+		if err != nil {
+			continue
+		}
+		forwarded = append(forwarded, batch...)
 	}
+	f.config.Metrics.OnEventsInboxed(len(forwarded))
+	return forwarded
+}
 
-	return nil
+func eventLogger(log *zap.Logger, event *eventpb.UserEvent) *zap.Logger {
+	return log.With(
+		zap.String("event_id", EventIDString(event.Event.Id)),
+		zap.String("user_id", model.UserIDString(event.UserId)),
+	)
 }
@@ -0,0 +1,162 @@
+package event
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+
+	eventpb "github.com/code-payments/flipcash-protobuf-api/generated/go/event/v1"
+
+	coderetry "github.com/code-payments/code-server/pkg/retry"
+	"github.com/code-payments/flipcash-server/model"
+)
+
+const (
+	// InboxEventExpiryTime is how long events are kept for replay
+	InboxEventExpiryTime = 3 * 24 * time.Hour
+
+	// Replayed batches are buffered by the stream before it starts sending, so
+	// leave room for live events arriving in the meantime
+	maxInboxReplayBatches = streamBufferSize / 2
+
+	// New app installs only replay events added within this window, rather than
+	// the user's whole inbox
+	newAppInstallReplayWindow = 5 * time.Minute
+)
+
+// addToInbox keeps a batch of events in their users' inboxes, so they're
+// replayed to each app install that doesn't receive them live. The events are
+// returned with their inbox sequences, to be forwarded.
+func addToInbox(ctx context.Context, log *zap.Logger, events Store, userEvents []*eventpb.UserEvent, retryStrategies ...coderetry.Strategy) ([]*ForwardedEvent, error) {
+	inboxEvents := make([]*InboxEvent, len(userEvents))
+	for i, userEvent := range userEvents {
+		inboxEvents[i] = &InboxEvent{
+			Key:       model.UserIDString(userEvent.UserId),
+			Event:     proto.Clone(userEvent.Event).(*eventpb.Event),
+			ExpiresAt: time.Now().Add(InboxEventExpiryTime),
+		}
+	}
+
+	_, err := coderetry.Retry(
+		func() error {
+			return events.AddInboxEvents(ctx, inboxEvents...)
+		},
+		retryStrategies...,
+	)
+	if err != nil {
+		log.With(zap.Error(err), zap.Int("batch_size", len(userEvents))).Warn("Failure adding events to inboxes")
+		return nil, err
+	}
+
+	forwarded := make([]*ForwardedEvent, len(userEvents))
+	for i, userEvent := range userEvents {
+		forwarded[i] = &ForwardedEvent{UserEvent: userEvent, Sequence: inboxEvents[i].Sequence}
+	}
+
+	log.With(zap.Int("batch_size", len(userEvents))).Debug("Added events to inboxes")
+	return forwarded, nil
+}
+
+// replayInbox notifies a newly opened stream of the events in the user's inbox
+// after the app install's cursor, so they pass through the stream's stale event
+// detectors like live events. New app installs start from the events added
+// within the replay window. When the client resumes from the last event it
+// received, events up to and including it are skipped. Clients resuming from
+// an event before the cursor, or that's expired, get the events after the
+// cursor. The IDs of the replayed and skipped events are returned, along with
+// the sequence of the last one, or zero if there weren't any. The caller moves
+// the app install's cursor past it once the client acknowledges the replay.
+// Anything beyond the replay limit is left for its next stream. Events stay in
+// the inbox until they expire, so they're replayed again if the stream closes
+// before they're acknowledged, and to the user's other app installs.
+func replayInbox(ctx context.Context, log *zap.Logger, events Store, streamKey, appInstallID string, resumeEventID *eventpb.EventId, stream Stream[[]*eventpb.Event]) (uint64, map[string]struct{}, error) {
+	err := events.DeleteExpiredInboxEvents(ctx, streamKey)
+	if err != nil {
+		log.With(zap.Error(err)).Warn("Failure deleting expired inbox events")
+	}
+
+	cursor, err := events.GetInboxCursor(ctx, streamKey, appInstallID)
+	if err == ErrInboxCursorNotFound {
+		cursor, err = startInboxCursor(ctx, events, streamKey, appInstallID)
+	}
+	if err != nil {
+		log.With(zap.Error(err)).Warn("Failure getting inbox cursor")
+		return 0, nil, err
+	}
+
+	var toReplay []*InboxEvent
+	for range maxInboxReplayBatches {
+		inboxEvents, err := events.GetInboxEvents(ctx, streamKey, cursor, maxEventBatchSize)
+		if err == ErrInboxEventNotFound {
+			break
+		} else if err != nil {
+			log.With(zap.Error(err)).Warn("Failure getting inbox events")
+			return 0, nil, err
+		}
+
+		toReplay = append(toReplay, inboxEvents...)
+		cursor = inboxEvents[len(inboxEvents)-1].Sequence
+
+		if len(inboxEvents) < maxEventBatchSize {
+			break
+		}
+	}
+
+	var replayedSequence uint64
+	replayedEventIDs := make(map[string]struct{})
+	if resumeEventID != nil {
+		for i, inboxEvent := range toReplay {
+			if bytes.Equal(inboxEvent.Event.Id.GetId(), resumeEventID.Id) {
+				log.With(zap.Int("num_skipped", i+1)).Debug("Resuming replay after the client's last received event")
+
+				for _, skipped := range toReplay[:i+1] {
+					replayedEventIDs[string(skipped.Event.Id.GetId())] = struct{}{}
+				}
+				replayedSequence = inboxEvent.Sequence
+				toReplay = toReplay[i+1:]
+				break
+			}
+		}
+	}
+
+	for start := 0; start < len(toReplay); start += maxEventBatchSize {
+		end := min(start+maxEventBatchSize, len(toReplay))
+
+		batch := make([]*eventpb.Event, end-start)
+		for i, inboxEvent := range toReplay[start:end] {
+			batch[i] = inboxEvent.Event
+		}
+
+		log.With(zap.Int("batch_size", len(batch))).Debug("Replaying inbox events")
+		if err := stream.Notify(batch, streamTimeout); err != nil {
+			log.With(zap.Error(err)).Warn("Failed to notify inbox events on local stream")
+			return 0, nil, err
+		}
+
+		for _, inboxEvent := range toReplay[start:end] {
+			replayedEventIDs[string(inboxEvent.Event.Id.GetId())] = struct{}{}
+		}
+		replayedSequence = toReplay[end-1].Sequence
+	}
+
+	return replayedSequence, replayedEventIDs, nil
+}
+
+// startInboxCursor creates the inbox cursor for a new app install, before the
+// events added within the replay window. The cursor is saved right away, so the
+// app install's later streams replay everything after it.
+func startInboxCursor(ctx context.Context, events Store, streamKey, appInstallID string) (uint64, error) {
+	cursor, err := events.GetInboxSequenceAddedBefore(ctx, streamKey, time.Now().Add(-newAppInstallReplayWindow))
+	if err != nil {
+		return 0, err
+	}
+
+	err = events.AdvanceInboxCursor(ctx, streamKey, appInstallID, cursor)
+	if err != nil {
+		return 0, err
+	}
+	return cursor, nil
+}
@@ -0,0 +1,15 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/code-payments/flipcash-server/event/tests"
+)
+
+func TestEvent_MemoryForwarder(t *testing.T) {
+	testStore := NewInMemory()
+	teardown := func() {
+		testStore.(*InMemoryStore).reset()
+	}
+	tests.RunForwarderTests(t, testStore, teardown)
+}
@@ -14,3 +14,11 @@ func TestEvent_MemoryServer(t *testing.T) {
 	}
 	tests.RunServerTests(t, accounts, events, teardown)
 }
+
+func TestEvent_MemoryDeliveryServer(t *testing.T) {
+	accounts := account_memory.NewInMemory()
+	events := NewInMemory()
+	teardown := func() {
+	}
+	tests.RunDeliveryServerTests(t, accounts, events, teardown)
+}
@@ -11,18 +11,29 @@ import (
 type InMemoryStore struct {
 	mu sync.RWMutex
 
-	rendezvous []*event.Rendezvous
+	rendezvous   []*event.Rendezvous
+	inbox        []*event.InboxEvent
+	lastSequence uint64
+	cursors      map[string]*inboxCursor // By key, then app install
+}
+
+type inboxCursor struct {
+	key       string
+	sequence  uint64
+	updatedAt time.Time
 }
 
 func NewInMemory() event.Store {
-	return &InMemoryStore{}
+	return &InMemoryStore{
+		cursors: make(map[string]*inboxCursor),
+	}
 }
 
 func (s *InMemoryStore) CreateRendezvous(ctx context.Context, rendezvous *event.Rendezvous) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if item := s.findByKey(rendezvous.Key); item != nil {
+	if item := s.findByKey(rendezvous.Key, rendezvous.AppInstallID); item != nil {
 		if item.ExpiresAt.After(time.Now()) {
 			return event.ErrRendezvousExists
 		}
@@ -36,11 +47,11 @@ func (s *InMemoryStore) CreateRendezvous(ctx context.Context, rendezvous *event.
 	return nil
 }
 
-func (s *InMemoryStore) GetRendezvous(ctx context.Context, key string) (*event.Rendezvous, error) {
+func (s *InMemoryStore) GetRendezvous(ctx context.Context, key, appInstallID string) (*event.Rendezvous, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	res := s.findByKey(key)
+	res := s.findByKey(key, appInstallID)
 	if res == nil {
 		return nil, event.ErrRendezvousNotFound
 	}
@@ -52,11 +63,28 @@ func (s *InMemoryStore) GetRendezvous(ctx context.Context, key string) (*event.R
 	return res.Clone(), nil
 }
 
-func (s *InMemoryStore) ExtendRendezvousExpiry(ctx context.Context, key, address string, expiresAt time.Time) error {
+func (s *InMemoryStore) GetRendezvousBatch(ctx context.Context, keys ...string) ([]*event.Rendezvous, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var res []*event.Rendezvous
+	for _, key := range keys {
+		for _, item := range s.rendezvous {
+			if item.Key != key || item.ExpiresAt.Before(time.Now()) {
+				continue
+			}
+
+			res = append(res, item.Clone())
+		}
+	}
+	return res, nil
+}
+
+func (s *InMemoryStore) ExtendRendezvousExpiry(ctx context.Context, key, appInstallID, address string, expiresAt time.Time) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	item := s.findByKeyAndAddress(key, address)
+	item := s.findByKeyAndAddress(key, appInstallID, address)
 	if item == nil {
 		return event.ErrRendezvousNotFound
 	}
@@ -70,12 +98,12 @@ func (s *InMemoryStore) ExtendRendezvousExpiry(ctx context.Context, key, address
 	return nil
 }
 
-func (s *InMemoryStore) DeleteRendezvous(ctx context.Context, key, address string) error {
+func (s *InMemoryStore) DeleteRendezvous(ctx context.Context, key, appInstallID, address string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	for i, item := range s.rendezvous {
-		if item.Key == key && item.Address == address {
+		if item.Key == key && item.AppInstallID == appInstallID && item.Address == address {
 			s.rendezvous = append(s.rendezvous[:i], s.rendezvous[i+1:]...)
 			return nil
 		}
@@ -84,9 +112,145 @@ func (s *InMemoryStore) DeleteRendezvous(ctx context.Context, key, address strin
 	return nil
 }
 
-func (s *InMemoryStore) findByKey(key string) *event.Rendezvous {
+func (s *InMemoryStore) AddInboxEvents(ctx context.Context, inboxEvents ...*event.InboxEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, inboxEvent := range inboxEvents {
+		s.lastSequence++
+
+		cloned := inboxEvent.Clone()
+		cloned.Sequence = s.lastSequence
+		cloned.CreatedAt = time.Now()
+		s.inbox = append(s.inbox, cloned)
+
+		inboxEvent.Sequence = cloned.Sequence
+		inboxEvent.CreatedAt = cloned.CreatedAt
+	}
+
+	return nil
+}
+
+func (s *InMemoryStore) GetInboxEvents(ctx context.Context, key string, cursor uint64, limit int) ([]*event.InboxEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var res []*event.InboxEvent
+	for _, item := range s.inbox {
+		if len(res) >= limit {
+			break
+		}
+
+		if item.Key != key || item.Sequence <= cursor || item.ExpiresAt.Before(time.Now()) {
+			continue
+		}
+
+		res = append(res, item.Clone())
+	}
+
+	if len(res) == 0 {
+		return nil, event.ErrInboxEventNotFound
+	}
+	return res, nil
+}
+
+func (s *InMemoryStore) DeleteExpiredInboxEvents(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var remaining []*event.InboxEvent
+	for _, item := range s.inbox {
+		if item.Key == key && item.ExpiresAt.Before(time.Now()) {
+			continue
+		}
+		remaining = append(remaining, item)
+	}
+	s.inbox = remaining
+
+	return nil
+}
+
+func (s *InMemoryStore) DeleteAllExpiredInboxEvents(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var remaining []*event.InboxEvent
+	for _, item := range s.inbox {
+		if item.ExpiresAt.Before(time.Now()) {
+			continue
+		}
+		remaining = append(remaining, item)
+	}
+	s.inbox = remaining
+
+	return nil
+}
+
+func (s *InMemoryStore) GetInboxSequenceAddedBefore(ctx context.Context, key string, addedBefore time.Time) (uint64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var res uint64
+	for _, item := range s.inbox {
+		if item.Key == key && item.CreatedAt.Before(addedBefore) {
+			res = max(res, item.Sequence)
+		}
+	}
+	return res, nil
+}
+
+func (s *InMemoryStore) GetInboxCursor(ctx context.Context, key, appInstallID string) (uint64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	cursor, ok := s.cursors[key+"/"+appInstallID]
+	if !ok {
+		return 0, event.ErrInboxCursorNotFound
+	}
+	return cursor.sequence, nil
+}
+
+func (s *InMemoryStore) AdvanceInboxCursor(ctx context.Context, key, appInstallID string, sequence uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cursorKey := key + "/" + appInstallID
+	cursor, ok := s.cursors[cursorKey]
+	if !ok {
+		s.cursors[cursorKey] = &inboxCursor{key: key, sequence: sequence, updatedAt: time.Now()}
+	} else if cursor.sequence < sequence {
+		cursor.sequence = sequence
+		cursor.updatedAt = time.Now()
+	}
+
+	return nil
+}
+
+func (s *InMemoryStore) DeleteStaleInboxCursors(ctx context.Context, movedBefore time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for cursorKey, cursor := range s.cursors {
+		if cursor.updatedAt.Before(movedBefore) && !s.hasInboxEventsAfter(cursor) {
+			delete(s.cursors, cursorKey)
+		}
+	}
+
+	return nil
+}
+
+func (s *InMemoryStore) hasInboxEventsAfter(cursor *inboxCursor) bool {
+	for _, item := range s.inbox {
+		if item.Key == cursor.key && item.Sequence > cursor.sequence && item.ExpiresAt.After(time.Now()) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *InMemoryStore) findByKey(key, appInstallID string) *event.Rendezvous {
 	for _, item := range s.rendezvous {
-		if item.Key == key {
+		if item.Key == key && item.AppInstallID == appInstallID {
 			return item
 		}
 	}
@@ -94,9 +258,9 @@ func (s *InMemoryStore) findByKey(key string) *event.Rendezvous {
 	return nil
 }
 
-func (s *InMemoryStore) findByKeyAndAddress(key, address string) *event.Rendezvous {
+func (s *InMemoryStore) findByKeyAndAddress(key, appInstallID, address string) *event.Rendezvous {
 	for _, item := range s.rendezvous {
-		if item.Key == key && item.Address == address {
+		if item.Key == key && item.AppInstallID == appInstallID && item.Address == address {
 			return item
 		}
 	}
@@ -109,4 +273,7 @@ func (s *InMemoryStore) reset() {
 	defer s.mu.Unlock()
 
 	s.rendezvous = nil
+	s.inbox = nil
+	s.lastSequence = 0
+	s.cursors = make(map[string]*inboxCursor)
 }
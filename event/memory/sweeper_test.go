@@ -0,0 +1,15 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/code-payments/flipcash-server/event/tests"
+)
+
+func TestEvent_MemorySweeper(t *testing.T) {
+	testStore := NewInMemory()
+	teardown := func() {
+		testStore.(*InMemoryStore).reset()
+	}
+	tests.RunSweeperTests(t, testStore, teardown)
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"google.golang.org/protobuf/proto"
 
 	eventpb "github.com/code-payments/flipcash-protobuf-api/generated/go/event/v1"
 )
@@ -34,15 +35,45 @@ type KeyAndEvent[Key, Event any] struct {
 }
 
 type Rendezvous struct {
-	Key       string
-	Address   string
-	ExpiresAt time.Time
+	Key          string
+	AppInstallID string // Empty for clients that don't identify their app install
+	Address      string
+	ExpiresAt    time.Time
 }
 
 func (r *Rendezvous) Clone() *Rendezvous {
 	return &Rendezvous{
-		Key:       r.Key,
-		Address:   r.Address,
-		ExpiresAt: r.ExpiresAt,
+		Key:          r.Key,
+		AppInstallID: r.AppInstallID,
+		Address:      r.Address,
+		ExpiresAt:    r.ExpiresAt,
 	}
 }
+
+// InboxEvent is an event kept in a user's inbox, so it can be replayed to each
+// of the user's app installs that didn't receive it live when they next open a
+// stream
+type InboxEvent struct {
+	Key       string // Same as the rendezvous key for the user's stream
+	Sequence  uint64 // Assigned by the store, increasing in the order events are added
+	Event     *eventpb.Event
+	CreatedAt time.Time // Assigned by the store
+	ExpiresAt time.Time
+}
+
+func (e *InboxEvent) Clone() *InboxEvent {
+	return &InboxEvent{
+		Key:       e.Key,
+		Sequence:  e.Sequence,
+		Event:     proto.Clone(e.Event).(*eventpb.Event),
+		CreatedAt: e.CreatedAt,
+		ExpiresAt: e.ExpiresAt,
+	}
+}
+
+// ForwardedEvent is a user event forwarded to the servers hosting the user's
+// streams, after it's been added to the user's inbox
+type ForwardedEvent struct {
+	UserEvent *eventpb.UserEvent
+	Sequence  uint64 // The event's sequence in the user's inbox
+}
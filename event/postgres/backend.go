@@ -0,0 +1,50 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+
+	"github.com/code-payments/flipcash-server/event"
+)
+
+// StreamBackendConfig selects how user events reach the servers hosting their
+// streams
+type StreamBackendConfig struct {
+	Type event.StreamBackendType
+
+	// Used by event.StreamBackendRendezvous
+	BroadcastAddress string
+	CurrentRpcApiKey string
+	Forwarder        event.ForwarderConfig
+
+	// Used by event.StreamBackendPostgresNotify
+	Notify NotifyConfig
+}
+
+// NewStreamBackend creates the stream backend selected by the config
+func NewStreamBackend(ctx context.Context, log *zap.Logger, pool *pgxpool.Pool, events event.Store, config StreamBackendConfig) (event.StreamBackendCtor, error) {
+	switch config.Type {
+	case event.StreamBackendRendezvous:
+		return event.NewRendezvousBackend(log, events, config.BroadcastAddress, config.CurrentRpcApiKey, config.Forwarder), nil
+	case event.StreamBackendPostgresNotify:
+		return NewNotifyBackend(ctx, log, pool, events, config.Notify), nil
+	default:
+		return nil, fmt.Errorf("unsupported stream backend type: %s", config.Type)
+	}
+}
+
+// NewForwarder creates a forwarder for processes that don't host event streams,
+// which publishes events the same way as the stream backend selected by the config
+func NewForwarder(ctx context.Context, log *zap.Logger, pool *pgxpool.Pool, events event.Store, config StreamBackendConfig) (event.Forwarder, error) {
+	switch config.Type {
+	case event.StreamBackendRendezvous:
+		return event.NewForwardingClient(log, events, config.CurrentRpcApiKey, config.Forwarder), nil
+	case event.StreamBackendPostgresNotify:
+		return NewNotifyForwarder(ctx, log, pool, events, config.Notify), nil
+	default:
+		return nil, fmt.Errorf("unsupported stream backend type: %s", config.Type)
+	}
+}
@@ -2,11 +2,16 @@ package postgres
 
 import (
 	"context"
+	"fmt"
+	"sort"
 	"time"
 
 	"github.com/georgysavva/scany/v2/pgxscan"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"google.golang.org/protobuf/proto"
+
+	eventpb "github.com/code-payments/flipcash-protobuf-api/generated/go/event/v1"
 
 	"github.com/code-payments/flipcash-server/event"
 
@@ -15,42 +20,94 @@ import (
 
 const (
 	rendezvousTableName = "flipcash_rendezvous"
-	allRendezvousFields = `"key", "address", "createdAt", "updatedAt", "expiresAt"`
+	allRendezvousFields = `"key", "appInstallId", "address", "createdAt", "updatedAt", "expiresAt"`
+
+	inboxTableName          = "flipcash_inboxevents"
+	allInboxFields          = `"id", "key", "event", "createdAt", "expiresAt"`
+	allInboxFieldsWithoutId = `"key", "event", "createdAt", "expiresAt"`
+
+	inboxCursorTableName = "flipcash_inboxcursors"
+	allInboxCursorFields = `"key", "appInstallId", "sequence", "createdAt", "updatedAt"`
 )
 
 type rendezvousModel struct {
-	Key       string    `db:"key"`
-	Address   string    `db:"address"`
-	CreatedAt time.Time `db:"createdAt"`
-	UpdatedAt time.Time `db:"updatedAt"`
-	ExpiresAt time.Time `db:"expiresAt"`
+	Key          string    `db:"key"`
+	AppInstallID string    `db:"appInstallId"`
+	Address      string    `db:"address"`
+	CreatedAt    time.Time `db:"createdAt"`
+	UpdatedAt    time.Time `db:"updatedAt"`
+	ExpiresAt    time.Time `db:"expiresAt"`
 }
 
 func toRendezvousModel(rendezvous *event.Rendezvous) *rendezvousModel {
 	return &rendezvousModel{
-		Key:       rendezvous.Key,
-		Address:   rendezvous.Address,
-		ExpiresAt: rendezvous.ExpiresAt,
+		Key:          rendezvous.Key,
+		AppInstallID: rendezvous.AppInstallID,
+		Address:      rendezvous.Address,
+		ExpiresAt:    rendezvous.ExpiresAt,
 	}
 }
 
 func fromRendezvousModel(model *rendezvousModel) *event.Rendezvous {
 	return &event.Rendezvous{
+		Key:          model.Key,
+		AppInstallID: model.AppInstallID,
+		Address:      model.Address,
+		ExpiresAt:    model.ExpiresAt,
+	}
+}
+
+type inboxModel struct {
+	ID        int64     `db:"id"`
+	Key       string    `db:"key"`
+	Event     string    `db:"event"`
+	CreatedAt time.Time `db:"createdAt"`
+	ExpiresAt time.Time `db:"expiresAt"`
+}
+
+func toInboxModel(inboxEvent *event.InboxEvent) (*inboxModel, error) {
+	marshalled, err := proto.Marshal(inboxEvent.Event)
+	if err != nil {
+		return nil, err
+	}
+
+	return &inboxModel{
+		ID:        int64(inboxEvent.Sequence),
+		Key:       inboxEvent.Key,
+		Event:     pg.Encode(marshalled),
+		ExpiresAt: inboxEvent.ExpiresAt,
+	}, nil
+}
+
+func fromInboxModel(model *inboxModel) (*event.InboxEvent, error) {
+	decoded, err := pg.Decode(model.Event)
+	if err != nil {
+		return nil, err
+	}
+
+	var unmarshalled eventpb.Event
+	if err := proto.Unmarshal(decoded, &unmarshalled); err != nil {
+		return nil, err
+	}
+
+	return &event.InboxEvent{
 		Key:       model.Key,
-		Address:   model.Address,
+		Sequence:  uint64(model.ID),
+		Event:     &unmarshalled,
+		CreatedAt: model.CreatedAt,
 		ExpiresAt: model.ExpiresAt,
-	}
+	}, nil
 }
 
 func (m *rendezvousModel) dbCreate(ctx context.Context, pool *pgxpool.Pool) error {
 	return pg.ExecuteInTx(ctx, pool, func(tx pgx.Tx) error {
 		query := `INSERT INTO ` + rendezvousTableName + `(` + allRendezvousFields + `)
-			VALUES ($1, $2, NOW(), NOW(), $3)
+			VALUES ($1, $2, $3, NOW(), NOW(), $4)
 
-			ON CONFLICT ("key")
+			ON CONFLICT ("key", "appInstallId")
 			DO UPDATE
-				SET "address" = $2, "expiresAt" = $3
-				WHERE ` + rendezvousTableName + `."key" = $1 AND ` + rendezvousTableName + `."expiresAt" < NOW()
+				SET "address" = $3, "expiresAt" = $4
+				WHERE ` + rendezvousTableName + `."key" = $1 AND ` + rendezvousTableName + `."appInstallId" = $2 AND ` + rendezvousTableName + `."expiresAt" < NOW()
 
 			RETURNING ` + allRendezvousFields
 		err := pgxscan.Get(
@@ -59,6 +116,7 @@ func (m *rendezvousModel) dbCreate(ctx context.Context, pool *pgxpool.Pool) erro
 			m,
 			query,
 			m.Key,
+			m.AppInstallID,
 			m.Address,
 			m.ExpiresAt.UTC(),
 		)
@@ -71,16 +129,17 @@ func (m *rendezvousModel) dbCreate(ctx context.Context, pool *pgxpool.Pool) erro
 	})
 }
 
-func dbGetRendezvous(ctx context.Context, pool *pgxpool.Pool, key string) (*rendezvousModel, error) {
+func dbGetRendezvous(ctx context.Context, pool *pgxpool.Pool, key, appInstallID string) (*rendezvousModel, error) {
 	res := &rendezvousModel{}
 	query := `SELECT ` + allRendezvousFields + ` FROM ` + rendezvousTableName + `
-		WHERE "key" = $1 AND "expiresAt" > NOW()`
+		WHERE "key" = $1 AND "appInstallId" = $2 AND "expiresAt" > NOW()`
 	err := pgxscan.Get(
 		ctx,
 		pool,
 		res,
 		query,
 		key,
+		appInstallID,
 	)
 	if err != nil {
 		if pgxscan.NotFound(err) {
@@ -91,16 +150,53 @@ func dbGetRendezvous(ctx context.Context, pool *pgxpool.Pool, key string) (*rend
 	return res, nil
 }
 
-func dbExtendRendezvousExpiry(ctx context.Context, pool *pgxpool.Pool, key, address string, expiresAt time.Time) error {
+func dbGetRendezvousBatch(ctx context.Context, pool *pgxpool.Pool, keys ...string) ([]*rendezvousModel, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	var res []*rendezvousModel
+
+	queryParameters := make([]any, len(keys))
+
+	query := `SELECT ` + allRendezvousFields + ` FROM ` + rendezvousTableName + ` WHERE "expiresAt" > NOW() AND "key" IN (`
+	for i, key := range keys {
+		queryParameters[i] = key
+		if i > 0 {
+			query += fmt.Sprintf(",$%d", i+1)
+		} else {
+			query += fmt.Sprintf("$%d", i+1)
+		}
+	}
+	query += ")"
+
+	err := pgxscan.Select(
+		ctx,
+		pool,
+		&res,
+		query,
+		queryParameters...,
+	)
+	if err != nil {
+		if pgxscan.NotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return res, nil
+}
+
+func dbExtendRendezvousExpiry(ctx context.Context, pool *pgxpool.Pool, key, appInstallID, address string, expiresAt time.Time) error {
 	return pg.ExecuteInTx(ctx, pool, func(tx pgx.Tx) error {
 		query := `UPDATE ` + rendezvousTableName + `
 			SET "expiresAt" = $1, "updatedAt" = NOW()
-			WHERE "key" = $2 AND "address" = $3 AND "expiresAt" > NOW()`
+			WHERE "key" = $2 AND "appInstallId" = $3 AND "address" = $4 AND "expiresAt" > NOW()`
 		cmd, err := tx.Exec(
 			ctx,
 			query,
 			expiresAt.UTC(),
 			key,
+			appInstallID,
 			address,
 		)
 		if err != nil {
@@ -113,16 +209,192 @@ func dbExtendRendezvousExpiry(ctx context.Context, pool *pgxpool.Pool, key, addr
 	})
 }
 
-func dbDeleteRendezvous(ctx context.Context, pool *pgxpool.Pool, key, address string) error {
+func dbDeleteRendezvous(ctx context.Context, pool *pgxpool.Pool, key, appInstallID, address string) error {
 	return pg.ExecuteInTx(ctx, pool, func(tx pgx.Tx) error {
 		query := `DELETE FROM ` + rendezvousTableName + `
-			WHERE "key" = $1 AND "address" = $2`
+			WHERE "key" = $1 AND "appInstallId" = $2 AND "address" = $3`
 		_, err := tx.Exec(
 			ctx,
 			query,
 			key,
+			appInstallID,
 			address,
 		)
 		return err
 	})
 }
+
+// dbPutInboxEvents inserts a batch of inbox events in a single statement, and
+// sets each model's ID and creation time
+func dbPutInboxEvents(ctx context.Context, pool *pgxpool.Pool, models []*inboxModel) error {
+	return pg.ExecuteInTx(ctx, pool, func(tx pgx.Tx) error {
+		type insertedRow struct {
+			ID        int64     `db:"id"`
+			CreatedAt time.Time `db:"createdAt"`
+		}
+
+		queryParameters := make([]any, 0, 3*len(models))
+
+		query := `INSERT INTO ` + inboxTableName + `(` + allInboxFieldsWithoutId + `) VALUES `
+		for i, m := range models {
+			if i > 0 {
+				query += ","
+			}
+			query += fmt.Sprintf("($%d, $%d, NOW(), $%d)", 3*i+1, 3*i+2, 3*i+3)
+			queryParameters = append(queryParameters, m.Key, m.Event, m.ExpiresAt.UTC())
+		}
+		query += ` RETURNING "id", "createdAt"`
+
+		var inserted []*insertedRow
+		err := pgxscan.Select(
+			ctx,
+			tx,
+			&inserted,
+			query,
+			queryParameters...,
+		)
+		if err != nil {
+			return err
+		}
+		if len(inserted) != len(models) {
+			return fmt.Errorf("inserted %d inbox events for %d models", len(inserted), len(models))
+		}
+
+		// IDs are assigned in the order rows are listed, but RETURNING doesn't
+		// guarantee the order rows come back in
+		sort.Slice(inserted, func(i, j int) bool {
+			return inserted[i].ID < inserted[j].ID
+		})
+		for i, m := range models {
+			m.ID = inserted[i].ID
+			m.CreatedAt = inserted[i].CreatedAt
+		}
+		return nil
+	})
+}
+
+func dbGetInboxEvents(ctx context.Context, pool *pgxpool.Pool, key string, cursor uint64, limit int) ([]*inboxModel, error) {
+	var res []*inboxModel
+	query := `SELECT ` + allInboxFields + ` FROM ` + inboxTableName + `
+		WHERE "key" = $1 AND "id" > $2 AND "expiresAt" > NOW()
+		ORDER BY "id" ASC
+		LIMIT $3`
+	err := pgxscan.Select(
+		ctx,
+		pool,
+		&res,
+		query,
+		key,
+		cursor,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(res) == 0 {
+		return nil, event.ErrInboxEventNotFound
+	}
+	return res, nil
+}
+
+func dbDeleteExpiredInboxEvents(ctx context.Context, pool *pgxpool.Pool, key string) error {
+	return pg.ExecuteInTx(ctx, pool, func(tx pgx.Tx) error {
+		query := `DELETE FROM ` + inboxTableName + `
+			WHERE "key" = $1 AND "expiresAt" < NOW()`
+		_, err := tx.Exec(
+			ctx,
+			query,
+			key,
+		)
+		return err
+	})
+}
+
+func dbDeleteAllExpiredInboxEvents(ctx context.Context, pool *pgxpool.Pool) error {
+	return pg.ExecuteInTx(ctx, pool, func(tx pgx.Tx) error {
+		query := `DELETE FROM ` + inboxTableName + `
+			WHERE "expiresAt" < NOW()`
+		_, err := tx.Exec(
+			ctx,
+			query,
+		)
+		return err
+	})
+}
+
+func dbGetInboxSequenceAddedBefore(ctx context.Context, pool *pgxpool.Pool, key string, addedBefore time.Time) (uint64, error) {
+	var sequence int64
+	query := `SELECT COALESCE(MAX("id"), 0) FROM ` + inboxTableName + `
+		WHERE "key" = $1 AND "createdAt" < $2`
+	err := pgxscan.Get(
+		ctx,
+		pool,
+		&sequence,
+		query,
+		key,
+		addedBefore.UTC(),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(sequence), nil
+}
+
+func dbGetInboxCursor(ctx context.Context, pool *pgxpool.Pool, key, appInstallID string) (uint64, error) {
+	var sequence int64
+	query := `SELECT "sequence" FROM ` + inboxCursorTableName + `
+		WHERE "key" = $1 AND "appInstallId" = $2`
+	err := pgxscan.Get(
+		ctx,
+		pool,
+		&sequence,
+		query,
+		key,
+		appInstallID,
+	)
+	if err != nil {
+		if pgxscan.NotFound(err) {
+			return 0, event.ErrInboxCursorNotFound
+		}
+		return 0, err
+	}
+	return uint64(sequence), nil
+}
+
+func dbAdvanceInboxCursor(ctx context.Context, pool *pgxpool.Pool, key, appInstallID string, sequence uint64) error {
+	return pg.ExecuteInTx(ctx, pool, func(tx pgx.Tx) error {
+		query := `INSERT INTO ` + inboxCursorTableName + `(` + allInboxCursorFields + `)
+			VALUES ($1, $2, $3, NOW(), NOW())
+
+			ON CONFLICT ("key", "appInstallId")
+			DO UPDATE
+				SET "sequence" = $3, "updatedAt" = NOW()
+				WHERE ` + inboxCursorTableName + `."sequence" < $3`
+		_, err := tx.Exec(
+			ctx,
+			query,
+			key,
+			appInstallID,
+			int64(sequence),
+		)
+		return err
+	})
+}
+
+func dbDeleteStaleInboxCursors(ctx context.Context, pool *pgxpool.Pool, movedBefore time.Time) error {
+	return pg.ExecuteInTx(ctx, pool, func(tx pgx.Tx) error {
+		query := `DELETE FROM ` + inboxCursorTableName + `
+			WHERE "updatedAt" < $1 AND NOT EXISTS (
+				SELECT 1 FROM ` + inboxTableName + `
+				WHERE ` + inboxTableName + `."key" = ` + inboxCursorTableName + `."key"
+					AND ` + inboxTableName + `."id" > ` + inboxCursorTableName + `."sequence"
+					AND ` + inboxTableName + `."expiresAt" > NOW()
+			)`
+		_, err := tx.Exec(
+			ctx,
+			query,
+			movedBefore.UTC(),
+		)
+		return err
+	})
+}
@@ -0,0 +1,774 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+
+	eventpb "github.com/code-payments/flipcash-protobuf-api/generated/go/event/v1"
+
+	coderetry "github.com/code-payments/code-server/pkg/retry"
+	codebackoff "github.com/code-payments/code-server/pkg/retry/backoff"
+	pg "github.com/code-payments/flipcash-server/database/postgres"
+	"github.com/code-payments/flipcash-server/event"
+	"github.com/code-payments/flipcash-server/model"
+)
+
+const (
+	notifyChannelPrefix = "flipcash_events_"
+
+	// Postgres rejects NOTIFY payloads of 8000 bytes or more
+	maxNotifyPayloadSize = 7999
+
+	// listenTimeout bounds how long opening a stream waits for the listener,
+	// which may be reconnecting
+	listenTimeout = 5 * time.Second
+
+	// Inbox events are added and read in batches of up to this size
+	maxInboxBatchSize = 1024
+)
+
+type NotifyConfig struct {
+	// NumShards is how many channels user events are spread across, by a hash
+	// of the user ID. Servers only listen on the channels of users streaming
+	// from them.
+	NumShards uint32
+
+	// ReconnectDelay is how long the listener waits to reconnect after losing
+	// its connection
+	ReconnectDelay time.Duration
+
+	// RetryStrategies apply to adding events to inboxes, publishing them and
+	// acknowledging their delivery
+	RetryStrategies []coderetry.Strategy
+
+	// MaxQueuedEvents caps the events waiting to be published, and the events
+	// waiting to be delivered to local streams, on each shard. Events beyond the
+	// cap are only added to their users' inboxes.
+	MaxQueuedEvents int
+}
+
+var DefaultNotifyConfig = NotifyConfig{
+	NumShards:      64,
+	ReconnectDelay: time.Second,
+	RetryStrategies: []coderetry.Strategy{
+		coderetry.Limit(3),
+		coderetry.Backoff(codebackoff.BinaryExponential(100*time.Millisecond), 500*time.Millisecond),
+	},
+	MaxQueuedEvents: 4096,
+}
+
+// notifyPayload carries an inbox event to listeners. Events too large for a
+// NOTIFY payload only carry their inbox key and sequence, and listeners read
+// them from the inbox.
+type notifyPayload struct {
+	Sequence uint64 `json:"sequence"`
+	Key      string `json:"key,omitempty"`
+	Event    string `json:"event,omitempty"`
+}
+
+// shardQueue holds the items waiting to be processed by a shard's goroutine
+type shardQueue[T any] struct {
+	mu      sync.Mutex
+	pending []T
+	signal  chan struct{}
+}
+
+func newShardQueue[T any]() *shardQueue[T] {
+	return &shardQueue[T]{signal: make(chan struct{}, 1)}
+}
+
+// push queues items up to the cap, and returns the items that didn't fit
+func (q *shardQueue[T]) push(maxQueued int, items ...T) []T {
+	q.mu.Lock()
+	numQueued := min(len(items), max(maxQueued-len(q.pending), 0))
+	q.pending = append(q.pending, items[:numQueued]...)
+	q.mu.Unlock()
+
+	if numQueued > 0 {
+		select {
+		case q.signal <- struct{}{}:
+		default:
+		}
+	}
+	return items[numQueued:]
+}
+
+// take waits for queued items, and returns all of them. False is returned when
+// the context is cancelled.
+func (q *shardQueue[T]) take(ctx context.Context) ([]T, bool) {
+	select {
+	case <-ctx.Done():
+		return nil, false
+	case <-q.signal:
+	}
+
+	q.mu.Lock()
+	pending := q.pending
+	q.pending = nil
+	q.mu.Unlock()
+	return pending, true
+}
+
+type notifyForwarder struct {
+	log *zap.Logger
+
+	pool   *pgxpool.Pool
+	events event.Store
+
+	config NotifyConfig
+
+	shards []*shardQueue[*eventpb.UserEvent]
+}
+
+// NewNotifyForwarder creates a forwarder that publishes user events over
+// Postgres NOTIFY. Events are added to the user's inbox before they're
+// published, so app installs without a stream replay them when they next open
+// one. Events are published until the context is cancelled.
+func NewNotifyForwarder(ctx context.Context, log *zap.Logger, pool *pgxpool.Pool, events event.Store, config NotifyConfig) event.Forwarder {
+	return newNotifyForwarder(ctx, log, pool, events, config)
+}
+
+func newNotifyForwarder(ctx context.Context, log *zap.Logger, pool *pgxpool.Pool, events event.Store, config NotifyConfig) *notifyForwarder {
+	if config.NumShards == 0 {
+		config.NumShards = DefaultNotifyConfig.NumShards
+	}
+	if config.ReconnectDelay <= 0 {
+		config.ReconnectDelay = DefaultNotifyConfig.ReconnectDelay
+	}
+	if config.MaxQueuedEvents <= 0 {
+		config.MaxQueuedEvents = DefaultNotifyConfig.MaxQueuedEvents
+	}
+
+	f := &notifyForwarder{
+		log: log,
+
+		pool:   pool,
+		events: events,
+
+		config: config,
+
+		shards: make([]*shardQueue[*eventpb.UserEvent], config.NumShards),
+	}
+
+	for shard := range f.shards {
+		f.shards[shard] = newShardQueue[*eventpb.UserEvent]()
+		go f.publishShard(ctx, uint32(shard))
+	}
+
+	return f
+}
+
+// ForwardUserEvents queues user events to be published. Each shard publishes
+// its events in order, so a user's events are received in the order they were
+// forwarded. Events that don't fit in their shard's queue are only added to
+// their users' inboxes.
+func (f *notifyForwarder) ForwardUserEvents(ctx context.Context, events ...*eventpb.UserEvent) error {
+	eventsByShard := make(map[uint32][]*eventpb.UserEvent)
+	for _, userEvent := range events {
+		shard := notifyShard(model.UserIDString(userEvent.UserId), f.config.NumShards)
+		eventsByShard[shard] = append(eventsByShard[shard], userEvent)
+	}
+
+	var overflow []*eventpb.UserEvent
+	for shard, shardEvents := range eventsByShard {
+		overflow = append(overflow, f.shards[shard].push(f.config.MaxQueuedEvents, shardEvents...)...)
+	}
+
+	if len(overflow) > 0 {
+		f.log.With(zap.Int("num_events", len(overflow))).Warn("Publish queue is full, only adding events to inboxes")
+		f.addToInbox(ctx, overflow)
+	}
+	return nil
+}
+
+func (f *notifyForwarder) publishShard(ctx context.Context, shard uint32) {
+	queue := f.shards[shard]
+	for {
+		pending, ok := queue.take(ctx)
+		if !ok {
+			return
+		}
+
+		for _, forwarded := range f.addToInbox(ctx, pending) {
+			f.publish(ctx, shard, forwarded)
+		}
+	}
+}
+
+// addToInbox adds events to their users' inboxes in batches, so app installs
+// without a stream replay them. The events that were added are returned, in
+// order, with their inbox sequences.
+func (f *notifyForwarder) addToInbox(ctx context.Context, userEvents []*eventpb.UserEvent) []*event.ForwardedEvent {
+	var res []*event.ForwardedEvent
+	for start := 0; start < len(userEvents); start += maxInboxBatchSize {
+		end := min(start+maxInboxBatchSize, len(userEvents))
+
+		batch := make([]*event.InboxEvent, end-start)
+		for i, userEvent := range userEvents[start:end] {
+			batch[i] = &event.InboxEvent{
+				Key:       model.UserIDString(userEvent.UserId),
+				Event:     proto.Clone(userEvent.Event).(*eventpb.Event),
+				ExpiresAt: time.Now().Add(event.InboxEventExpiryTime),
+			}
+		}
+
+		_, err := coderetry.Retry(
+			func() error {
+				return f.events.AddInboxEvents(ctx, batch...)
+			},
+			f.config.RetryStrategies...,
+		)
+		if err != nil {
+			f.log.With(zap.Error(err), zap.Int("batch_size", len(batch))).Warn("Failure adding events to inboxes")
+			continue
+		}
+
+		for i, userEvent := range userEvents[start:end] {
+			res = append(res, &event.ForwardedEvent{UserEvent: userEvent, Sequence: batch[i].Sequence})
+		}
+	}
+	return res
+}
+
+func (f *notifyForwarder) publish(ctx context.Context, shard uint32, forwarded *event.ForwardedEvent) {
+	key := model.UserIDString(forwarded.UserEvent.UserId)
+	log := f.log.With(
+		zap.String("event_id", event.EventIDString(forwarded.UserEvent.Event.Id)),
+		zap.String("user_id", key),
+	)
+
+	payload, err := toNotifyPayload(forwarded.Sequence, forwarded.UserEvent)
+	if err != nil {
+		log.With(zap.Error(err)).Warn("Failure encoding notify payload")
+		return
+	}
+
+	if len(payload) > maxNotifyPayloadSize {
+		log.Debug("Event exceeds notify payload limit, publishing its inbox sequence")
+
+		payload, err = toNotifyInboxPayload(forwarded.Sequence, key)
+		if err != nil {
+			log.With(zap.Error(err)).Warn("Failure encoding notify payload")
+			return
+		}
+	}
+
+	_, err = coderetry.Retry(
+		func() error {
+			_, err := f.pool.Exec(ctx, `SELECT pg_notify($1, $2)`, notifyChannel(shard), payload)
+			return err
+		},
+		f.config.RetryStrategies...,
+	)
+	if err != nil {
+		log.With(zap.Error(err)).Warn("Failure publishing event, leaving it in the inbox")
+		return
+	}
+
+	log.Debug("Published event")
+}
+
+type listenRequest struct {
+	shard        uint32
+	key          string
+	streamKey    string
+	isRegistered bool
+	sequence     uint64 // Inbox head when the stream registered
+	result       chan error
+}
+
+// notifyDelivery is an event waiting to be delivered to local streams, either
+// as a notify payload or as an inbox event read after a reconnect
+type notifyDelivery struct {
+	payload    string
+	inboxEvent *event.InboxEvent
+}
+
+type notifyBackend struct {
+	*notifyForwarder
+
+	local event.LocalStreams
+
+	requests chan *listenRequest
+	wake     chan struct{}
+
+	deliveries      []*shardQueue[*notifyDelivery]
+	shardsByChannel map[string]uint32
+
+	deliveredMu    sync.Mutex
+	deliveredByKey map[string]uint64 // Latest inbox sequence delivered to each user streaming here
+
+	// Only used by the listener goroutine
+	streamsByShard map[uint32]map[string]struct{}
+}
+
+// NewNotifyBackend creates a stream backend that publishes user events over
+// Postgres NOTIFY, on channels sharded by user. Each server listens on the
+// channels of the users streaming from it, and delivers events to the streams
+// it hosts. Events are published and listened for until the context is
+// cancelled.
+//
+// There are no rendezvous records, so an app install's stream isn't aborted
+// when it's reopened on another server.
+func NewNotifyBackend(ctx context.Context, log *zap.Logger, pool *pgxpool.Pool, events event.Store, config NotifyConfig) event.StreamBackendCtor {
+	return func(local event.LocalStreams) event.StreamBackend {
+		b := &notifyBackend{
+			notifyForwarder: newNotifyForwarder(ctx, log, pool, events, config),
+
+			local: local,
+
+			requests: make(chan *listenRequest, 1024),
+			wake:     make(chan struct{}, 1),
+
+			shardsByChannel: make(map[string]uint32),
+
+			deliveredByKey: make(map[string]uint64),
+
+			streamsByShard: make(map[uint32]map[string]struct{}),
+		}
+
+		// Each shard delivers on its own goroutine, so a slow stream only delays
+		// the events on its shard
+		b.deliveries = make([]*shardQueue[*notifyDelivery], b.config.NumShards)
+		for shard := range b.deliveries {
+			b.deliveries[shard] = newShardQueue[*notifyDelivery]()
+			b.shardsByChannel[notifyChannel(uint32(shard))] = uint32(shard)
+			go b.deliverShard(ctx, uint32(shard))
+		}
+
+		go b.listen(ctx)
+
+		return b
+	}
+}
+
+// RegisterStream returns once the server is listening on the user's channel,
+// so events published after the inbox replay reach the stream
+func (b *notifyBackend) RegisterStream(ctx context.Context, key, appInstallID string) error {
+	ctx, cancel := context.WithTimeout(ctx, listenTimeout)
+	defer cancel()
+
+	// Events up to the inbox head are left to the stream's replay, if the
+	// listener reconnects before any are delivered live
+	head, err := b.events.GetInboxSequenceAddedBefore(ctx, key, time.Now())
+	if err != nil {
+		return err
+	}
+
+	req := b.newListenRequest(key, appInstallID, true)
+	req.sequence = head
+	if err := b.submit(ctx, req); err != nil {
+		return err
+	}
+
+	select {
+	case err := <-req.result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// RefreshStream is a no-op, since nothing expires while the stream is open
+func (b *notifyBackend) RefreshStream(_ context.Context, _, _ string) error {
+	return nil
+}
+
+// UnregisterStream doesn't wait for the server to stop listening, since events
+// for users without a stream here are ignored
+func (b *notifyBackend) UnregisterStream(ctx context.Context, key, appInstallID string) error {
+	return b.submit(ctx, b.newListenRequest(key, appInstallID, false))
+}
+
+func (b *notifyBackend) newListenRequest(key, appInstallID string, isRegistered bool) *listenRequest {
+	return &listenRequest{
+		shard:        notifyShard(key, b.config.NumShards),
+		key:          key,
+		streamKey:    key + "/" + appInstallID,
+		isRegistered: isRegistered,
+		result:       make(chan error, 1),
+	}
+}
+
+func (b *notifyBackend) submit(ctx context.Context, req *listenRequest) error {
+	select {
+	case b.requests <- req:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	// Interrupt the listener's wait, so it picks up the request
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (b *notifyBackend) listen(ctx context.Context) {
+	for {
+		err := b.listenOnConn(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		b.log.With(zap.Error(err)).Warn("Lost event listener connection, reconnecting")
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(b.config.ReconnectDelay):
+		}
+	}
+}
+
+func (b *notifyBackend) listenOnConn(ctx context.Context) error {
+	// LISTEN is bound to a session, so the listener has its own connection
+	// outside the pool
+	conn, err := pgx.ConnectConfig(ctx, b.pool.Config().ConnConfig.Copy())
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	// Resume listening for streams registered before a reconnect
+	listening := make(map[uint32]struct{})
+	for shard := range b.streamsByShard {
+		if _, err := conn.Exec(ctx, "LISTEN "+notifyChannelIdentifier(shard)); err != nil {
+			return err
+		}
+		listening[shard] = struct{}{}
+	}
+
+	// Events published while reconnecting weren't received, so they're read
+	// from the inboxes of the users streaming here
+	if len(listening) > 0 {
+		b.catchUp(ctx)
+	}
+
+	for {
+		if err := b.applyListenRequests(ctx, conn, listening); err != nil {
+			return err
+		}
+
+		waitCtx, cancel := context.WithCancel(ctx)
+		go func() {
+			select {
+			case <-b.wake:
+				cancel()
+			case <-waitCtx.Done():
+			}
+		}()
+
+		notification, err := conn.WaitForNotification(waitCtx)
+		cancel()
+
+		// Cancelling the wait leaves the connection open, so it's only lost when
+		// it's been closed
+		if err != nil {
+			if ctx.Err() != nil || conn.IsClosed() {
+				return err
+			}
+			continue
+		}
+
+		b.enqueueDelivery(notification)
+	}
+}
+
+func (b *notifyBackend) applyListenRequests(ctx context.Context, conn *pgx.Conn, listening map[uint32]struct{}) error {
+	for {
+		select {
+		case req := <-b.requests:
+			err := b.applyListenRequest(ctx, conn, listening, req)
+			req.result <- err
+			if err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+	}
+}
+
+func (b *notifyBackend) applyListenRequest(ctx context.Context, conn *pgx.Conn, listening map[uint32]struct{}, req *listenRequest) error {
+	streams, ok := b.streamsByShard[req.shard]
+	if req.isRegistered {
+		if !ok {
+			streams = make(map[string]struct{})
+			b.streamsByShard[req.shard] = streams
+		}
+		streams[req.streamKey] = struct{}{}
+	} else {
+		delete(streams, req.streamKey)
+		if len(streams) == 0 {
+			delete(b.streamsByShard, req.shard)
+		}
+	}
+	b.trackDelivered(req, streams)
+
+	_, hasStreams := b.streamsByShard[req.shard]
+	_, isListening := listening[req.shard]
+
+	switch {
+	case hasStreams && !isListening:
+		if _, err := conn.Exec(ctx, "LISTEN "+notifyChannelIdentifier(req.shard)); err != nil {
+			return err
+		}
+		listening[req.shard] = struct{}{}
+	case !hasStreams && isListening:
+		if _, err := conn.Exec(ctx, "UNLISTEN "+notifyChannelIdentifier(req.shard)); err != nil {
+			return err
+		}
+		delete(listening, req.shard)
+	}
+	return nil
+}
+
+// trackDelivered starts tracking the inbox events delivered to a user when
+// their first stream here registers, and stops once their last one unregisters
+func (b *notifyBackend) trackDelivered(req *listenRequest, shardStreams map[string]struct{}) {
+	b.deliveredMu.Lock()
+	defer b.deliveredMu.Unlock()
+
+	if req.isRegistered {
+		if _, ok := b.deliveredByKey[req.key]; !ok {
+			b.deliveredByKey[req.key] = req.sequence
+		}
+		return
+	}
+
+	for streamKey := range shardStreams {
+		if strings.HasPrefix(streamKey, req.key+"/") {
+			return
+		}
+	}
+	delete(b.deliveredByKey, req.key)
+}
+
+// catchUp queues the inbox events added after the latest one delivered to each
+// user streaming here. Events published after listening resumed can be
+// delivered twice.
+func (b *notifyBackend) catchUp(ctx context.Context) {
+	b.deliveredMu.Lock()
+	deliveredByKey := make(map[string]uint64, len(b.deliveredByKey))
+	for key, sequence := range b.deliveredByKey {
+		deliveredByKey[key] = sequence
+	}
+	b.deliveredMu.Unlock()
+
+	for key, cursor := range deliveredByKey {
+		log := b.log.With(zap.String("user_id", key))
+
+		var missed []*notifyDelivery
+		for {
+			inboxEvents, err := b.events.GetInboxEvents(ctx, key, cursor, maxInboxBatchSize)
+			if err == event.ErrInboxEventNotFound {
+				break
+			} else if err != nil {
+				log.With(zap.Error(err)).Warn("Failure getting inbox events missed while reconnecting")
+				break
+			}
+
+			for _, inboxEvent := range inboxEvents {
+				missed = append(missed, &notifyDelivery{inboxEvent: inboxEvent})
+			}
+			cursor = inboxEvents[len(inboxEvents)-1].Sequence
+
+			if len(inboxEvents) < maxInboxBatchSize {
+				break
+			}
+		}
+
+		if len(missed) == 0 {
+			continue
+		}
+
+		log.With(zap.Int("num_events", len(missed))).Debug("Delivering inbox events missed while reconnecting")
+		if overflow := b.deliveries[notifyShard(key, b.config.NumShards)].push(b.config.MaxQueuedEvents, missed...); len(overflow) > 0 {
+			log.With(zap.Int("num_events", len(overflow))).Warn("Delivery queue is full, leaving events in inboxes")
+		}
+	}
+}
+
+// enqueueDelivery queues a notification for delivery on its shard's goroutine,
+// so the listener isn't held up by slow streams
+func (b *notifyBackend) enqueueDelivery(notification *pgconn.Notification) {
+	shard, ok := b.shardsByChannel[notification.Channel]
+	if !ok {
+		b.log.With(zap.String("channel", notification.Channel)).Warn("Notification on unknown channel")
+		return
+	}
+
+	overflow := b.deliveries[shard].push(b.config.MaxQueuedEvents, &notifyDelivery{payload: notification.Payload})
+	if len(overflow) > 0 {
+		b.log.With(zap.String("channel", notification.Channel)).Warn("Delivery queue is full, leaving event in inbox")
+	}
+}
+
+func (b *notifyBackend) deliverShard(ctx context.Context, shard uint32) {
+	queue := b.deliveries[shard]
+	for {
+		pending, ok := queue.take(ctx)
+		if !ok {
+			return
+		}
+
+		for _, delivery := range pending {
+			b.deliver(ctx, delivery)
+		}
+	}
+}
+
+func (b *notifyBackend) deliver(ctx context.Context, delivery *notifyDelivery) {
+	inboxEvent := delivery.inboxEvent
+	if inboxEvent == nil {
+		sequence, key, userEvent, err := fromNotifyPayload(delivery.payload)
+		if err != nil {
+			b.log.With(zap.Error(err)).Warn("Failure decoding notify payload")
+			return
+		}
+
+		if userEvent != nil {
+			inboxEvent = &event.InboxEvent{
+				Key:      model.UserIDString(userEvent.UserId),
+				Sequence: sequence,
+				Event:    userEvent.Event,
+			}
+		} else {
+			inboxEvent, err = b.getInboxEvent(ctx, key, sequence)
+			if err != nil {
+				b.log.With(zap.Error(err), zap.String("user_id", key)).Warn("Failure getting published inbox event")
+				return
+			}
+		}
+	}
+
+	key := inboxEvent.Key
+	sequence := inboxEvent.Sequence
+	log := b.log.With(
+		zap.String("event_id", event.EventIDString(inboxEvent.Event.Id)),
+		zap.String("user_id", key),
+	)
+
+	appInstallIDs, err := b.local.DeliverInboxEvent(ctx, inboxEvent)
+	if err != nil {
+		log.With(zap.Error(err)).Warn("Failure delivering event to local streams")
+		return
+	}
+
+	b.deliveredMu.Lock()
+	if delivered, ok := b.deliveredByKey[key]; ok {
+		b.deliveredByKey[key] = max(delivered, sequence)
+	}
+	b.deliveredMu.Unlock()
+
+	// Only the app installs that received the event skip it. The user's other
+	// app installs, streaming from other servers sharing the channel or without
+	// a stream, are left to replay it from the inbox.
+	for _, appInstallID := range appInstallIDs {
+		go func() {
+			_, err := coderetry.Retry(
+				func() error {
+					return b.events.AdvanceInboxCursor(ctx, key, appInstallID, sequence)
+				},
+				b.config.RetryStrategies...,
+			)
+			if err != nil {
+				log.With(zap.Error(err), zap.String("app_install_id", appInstallID)).Warn("Failure advancing inbox cursor")
+			}
+		}()
+	}
+}
+
+// getInboxEvent reads an event published by its inbox sequence
+func (b *notifyBackend) getInboxEvent(ctx context.Context, key string, sequence uint64) (*event.InboxEvent, error) {
+	inboxEvents, err := b.events.GetInboxEvents(ctx, key, sequence-1, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(inboxEvents) == 0 || inboxEvents[0].Sequence != sequence {
+		return nil, fmt.Errorf("inbox event %d not found", sequence)
+	}
+	return inboxEvents[0], nil
+}
+
+func toNotifyPayload(sequence uint64, userEvent *eventpb.UserEvent) (string, error) {
+	marshalled, err := proto.Marshal(userEvent)
+	if err != nil {
+		return "", err
+	}
+
+	encoded, err := json.Marshal(&notifyPayload{
+		Sequence: sequence,
+		Event:    pg.Encode(marshalled),
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
+
+func toNotifyInboxPayload(sequence uint64, key string) (string, error) {
+	encoded, err := json.Marshal(&notifyPayload{
+		Sequence: sequence,
+		Key:      key,
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
+
+// fromNotifyPayload decodes a notify payload. The user event is nil when the
+// payload only carries the event's inbox key and sequence.
+func fromNotifyPayload(payload string) (uint64, string, *eventpb.UserEvent, error) {
+	var decoded notifyPayload
+	if err := json.Unmarshal([]byte(payload), &decoded); err != nil {
+		return 0, "", nil, err
+	}
+
+	if len(decoded.Event) == 0 {
+		if len(decoded.Key) == 0 {
+			return 0, "", nil, errors.New("notify payload has no event or inbox key")
+		}
+		return decoded.Sequence, decoded.Key, nil, nil
+	}
+
+	marshalled, err := pg.Decode(decoded.Event)
+	if err != nil {
+		return 0, "", nil, err
+	}
+
+	var userEvent eventpb.UserEvent
+	if err := proto.Unmarshal(marshalled, &userEvent); err != nil {
+		return 0, "", nil, err
+	}
+	return decoded.Sequence, decoded.Key, &userEvent, nil
+}
+
+func notifyShard(key string, numShards uint32) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return h.Sum32() % numShards
+}
+
+func notifyChannel(shard uint32) string {
+	return fmt.Sprintf("%s%d", notifyChannelPrefix, shard)
+}
+
+func notifyChannelIdentifier(shard uint32) string {
+	return pgx.Identifier{notifyChannel(shard)}.Sanitize()
+}
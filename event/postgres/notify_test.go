@@ -0,0 +1,57 @@
+//go:build integration
+
+package postgres
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	account_postgres "github.com/code-payments/flipcash-server/account/postgres"
+	"github.com/code-payments/flipcash-server/event"
+	"github.com/code-payments/flipcash-server/event/tests"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+func TestEvent_PostgresNotifyServer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pool, err := pgxpool.New(ctx, testEnv.DatabaseUrl)
+	require.NoError(t, err)
+	defer pool.Close()
+
+	accounts := account_postgres.NewInPostgres(pool)
+	events := NewInPostgres(pool)
+	newBackend := func(log *zap.Logger, events event.Store, _, _ string) event.StreamBackendCtor {
+		return NewNotifyBackend(ctx, log, pool, events, DefaultNotifyConfig)
+	}
+	teardown := func() {
+		events.(*store).reset()
+	}
+	tests.RunStreamBackendTests(t, accounts, events, newBackend, teardown)
+}
+
+func TestEvent_PostgresNotifyServer_ZeroConfig(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pool, err := pgxpool.New(ctx, testEnv.DatabaseUrl)
+	require.NoError(t, err)
+	defer pool.Close()
+
+	// Unset config values fall back to the defaults
+	accounts := account_postgres.NewInPostgres(pool)
+	events := NewInPostgres(pool)
+	newBackend := func(log *zap.Logger, events event.Store, _, _ string) event.StreamBackendCtor {
+		return NewNotifyBackend(ctx, log, pool, events, NotifyConfig{})
+	}
+	teardown := func() {
+		events.(*store).reset()
+	}
+	tests.RunStreamBackendTests(t, accounts, events, newBackend, teardown)
+}
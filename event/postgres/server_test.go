@@ -27,3 +27,16 @@ func TestEvent_PostgresServer(t *testing.T) {
 	}
 	tests.RunServerTests(t, accounts, events, teardown)
 }
+
+func TestEvent_PostgresDeliveryServer(t *testing.T) {
+	pool, err := pgxpool.New(context.Background(), testEnv.DatabaseUrl)
+	require.NoError(t, err)
+	defer pool.Close()
+
+	accounts := account_postgres.NewInPostgres(pool)
+	events := NewInPostgres(pool)
+	teardown := func() {
+		events.(*store).reset()
+	}
+	tests.RunDeliveryServerTests(t, accounts, events, teardown)
+}
@@ -24,20 +24,99 @@ func (s *store) CreateRendezvous(ctx context.Context, rendezvous *event.Rendezvo
 	return model.dbCreate(ctx, s.pool)
 }
 
-func (s *store) GetRendezvous(ctx context.Context, key string) (*event.Rendezvous, error) {
-	model, err := dbGetRendezvous(ctx, s.pool, key)
+func (s *store) GetRendezvous(ctx context.Context, key, appInstallID string) (*event.Rendezvous, error) {
+	model, err := dbGetRendezvous(ctx, s.pool, key, appInstallID)
 	if err != nil {
 		return nil, err
 	}
 	return fromRendezvousModel(model), nil
 }
 
-func (s *store) ExtendRendezvousExpiry(ctx context.Context, key, address string, expiresAt time.Time) error {
-	return dbExtendRendezvousExpiry(ctx, s.pool, key, address, expiresAt)
+func (s *store) GetRendezvousBatch(ctx context.Context, keys ...string) ([]*event.Rendezvous, error) {
+	models, err := dbGetRendezvousBatch(ctx, s.pool, keys...)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*event.Rendezvous, len(models))
+	for i, model := range models {
+		res[i] = fromRendezvousModel(model)
+	}
+	return res, nil
+}
+
+func (s *store) ExtendRendezvousExpiry(ctx context.Context, key, appInstallID, address string, expiresAt time.Time) error {
+	return dbExtendRendezvousExpiry(ctx, s.pool, key, appInstallID, address, expiresAt)
+}
+
+func (s *store) DeleteRendezvous(ctx context.Context, key, appInstallID, address string) error {
+	return dbDeleteRendezvous(ctx, s.pool, key, appInstallID, address)
+}
+
+func (s *store) AddInboxEvents(ctx context.Context, inboxEvents ...*event.InboxEvent) error {
+	if len(inboxEvents) == 0 {
+		return nil
+	}
+
+	models := make([]*inboxModel, len(inboxEvents))
+	for i, inboxEvent := range inboxEvents {
+		model, err := toInboxModel(inboxEvent)
+		if err != nil {
+			return err
+		}
+		models[i] = model
+	}
+
+	if err := dbPutInboxEvents(ctx, s.pool, models); err != nil {
+		return err
+	}
+
+	for i, model := range models {
+		inboxEvents[i].Sequence = uint64(model.ID)
+		inboxEvents[i].CreatedAt = model.CreatedAt
+	}
+
+	return nil
+}
+
+func (s *store) GetInboxEvents(ctx context.Context, key string, cursor uint64, limit int) ([]*event.InboxEvent, error) {
+	models, err := dbGetInboxEvents(ctx, s.pool, key, cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*event.InboxEvent, len(models))
+	for i, model := range models {
+		res[i], err = fromInboxModel(model)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+func (s *store) DeleteExpiredInboxEvents(ctx context.Context, key string) error {
+	return dbDeleteExpiredInboxEvents(ctx, s.pool, key)
+}
+
+func (s *store) DeleteAllExpiredInboxEvents(ctx context.Context) error {
+	return dbDeleteAllExpiredInboxEvents(ctx, s.pool)
+}
+
+func (s *store) GetInboxSequenceAddedBefore(ctx context.Context, key string, addedBefore time.Time) (uint64, error) {
+	return dbGetInboxSequenceAddedBefore(ctx, s.pool, key, addedBefore)
+}
+
+func (s *store) GetInboxCursor(ctx context.Context, key, appInstallID string) (uint64, error) {
+	return dbGetInboxCursor(ctx, s.pool, key, appInstallID)
+}
+
+func (s *store) AdvanceInboxCursor(ctx context.Context, key, appInstallID string, sequence uint64) error {
+	return dbAdvanceInboxCursor(ctx, s.pool, key, appInstallID, sequence)
 }
 
-func (s *store) DeleteRendezvous(ctx context.Context, key, address string) error {
-	return dbDeleteRendezvous(ctx, s.pool, key, address)
+func (s *store) DeleteStaleInboxCursors(ctx context.Context, movedBefore time.Time) error {
+	return dbDeleteStaleInboxCursors(ctx, s.pool, movedBefore)
 }
 
 func (s *store) reset() {
@@ -45,4 +124,14 @@ func (s *store) reset() {
 	if err != nil {
 		panic(err)
 	}
+
+	_, err = s.pool.Exec(context.Background(), "DELETE FROM "+inboxTableName)
+	if err != nil {
+		panic(err)
+	}
+
+	_, err = s.pool.Exec(context.Background(), "DELETE FROM "+inboxCursorTableName)
+	if err != nil {
+		panic(err)
+	}
 }
@@ -6,7 +6,6 @@ import (
 	"time"
 
 	"github.com/google/uuid"
-	"github.com/pkg/errors"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
@@ -19,8 +18,6 @@ import (
 	eventpb "github.com/code-payments/flipcash-protobuf-api/generated/go/event/v1"
 
 	codeheaders "github.com/code-payments/code-server/pkg/grpc/headers"
-	coderetry "github.com/code-payments/code-server/pkg/retry"
-	codebackoff "github.com/code-payments/code-server/pkg/retry/backoff"
 	"github.com/code-payments/flipcash-server/account"
 	"github.com/code-payments/flipcash-server/auth"
 	"github.com/code-payments/flipcash-server/model"
@@ -41,6 +38,15 @@ const (
 	forwardRpcTimeout = 250 * time.Millisecond
 
 	internalRpcApiKeyHeaderName = "x-flipcash-internal-rpc-api-key"
+
+	// todo: Move to StreamEventsRequest.Params when the proto supports it
+	appInstallIDHeaderName = "x-flipcash-app-install-id"
+
+	// todo: Move to StreamEventsRequest.Params when the proto supports it
+	resumeEventIDHeaderName = "x-flipcash-resume-event-id"
+
+	// todo: Move to UserEvent when the proto supports it
+	inboxSequencesHeaderName = "x-flipcash-inbox-sequences"
 )
 
 type StaleEventDetectorCtor[Event any] func() StaleEventDetector[Event]
@@ -60,14 +66,17 @@ type Server struct {
 	eventBus *Bus[*commonpb.UserId, *eventpb.Event]
 
 	streamsMu               sync.RWMutex
-	individualStreamMu      map[string]*sync.Mutex
-	streams                 map[string]Stream[[]*eventpb.Event]
+	individualStreamMu      map[string]*sync.Mutex                  // By device stream key
+	streams                 map[string]map[string]*appInstallStream // By stream key, then app install
 	staleEventDetectorCtors []StaleEventDetectorCtor[*eventpb.Event]
 
 	broadcastAddress      string
 	allInternalRpcApiKeys map[string]any
 	currentRpcApiKey      string
 
+	localStreams LocalStreams
+	backend      StreamBackend
+
 	eventpb.UnimplementedEventStreamingServer
 }
 
@@ -80,6 +89,7 @@ func NewServer(
 	staleEventDetectorCtors []StaleEventDetectorCtor[*eventpb.Event],
 	broadcastAddress string,
 	currentRpcApiKey string,
+	newBackend StreamBackendCtor,
 ) *Server {
 	s := &Server{
 		log: log,
@@ -92,7 +102,7 @@ func NewServer(
 		eventBus: eventBus,
 
 		individualStreamMu:      make(map[string]*sync.Mutex),
-		streams:                 make(map[string]Stream[[]*eventpb.Event]),
+		streams:                 make(map[string]map[string]*appInstallStream),
 		staleEventDetectorCtors: staleEventDetectorCtors,
 
 		broadcastAddress:      broadcastAddress,
@@ -102,6 +112,9 @@ func NewServer(
 
 	s.allInternalRpcApiKeys[currentRpcApiKey] = true
 
+	s.localStreams = &localStreamTransport{s}
+	s.backend = newBackend(s.localStreams)
+
 	eventBus.AddHandler(HandlerFunc[*commonpb.UserId, *eventpb.Event](s.OnEvent))
 
 	return s
@@ -148,14 +161,38 @@ func (s *Server) StreamEvents(stream grpc.BidiStreamingServer[eventpb.StreamEven
 		}})
 	}
 
+	// Each app install has its own stream. Clients that don't identify their app
+	// install share a single stream per user.
+	appInstallID, err := codeheaders.GetASCIIHeaderByName(ctx, appInstallIDHeaderName)
+	if err != nil {
+		log.With(zap.Error(err)).Warn("Failure getting app install header")
+		return status.Error(codes.Internal, "failure getting app install header")
+	}
+
+	// Clients resume from the last event they received, so it isn't replayed
+	resumeEventID, err := getResumeEventID(ctx)
+	if err != nil {
+		log.With(zap.Error(err)).Debug("Invalid resume event header")
+		return status.Error(codes.InvalidArgument, "invalid resume event id")
+	}
+
 	streamID := uuid.New()
 	streamKey := model.UserIDString(userID)
+	deviceStreamKey := streamKey + "/" + appInstallID
 
-	log = log.With(zap.String("stream_id", streamID.String()))
+	log = log.With(
+		zap.String("stream_id", streamID.String()),
+		zap.String("app_install_id", appInstallID),
+	)
 
 	s.streamsMu.Lock()
-	if existing, exists := s.streams[streamKey]; exists {
-		delete(s.streams, streamKey)
+	userStreams, ok := s.streams[streamKey]
+	if !ok {
+		userStreams = make(map[string]*appInstallStream)
+		s.streams[streamKey] = userStreams
+	}
+	if existing, exists := userStreams[appInstallID]; exists {
+		delete(userStreams, appInstallID)
 		existing.Close()
 
 		log.Info("Closed previous stream")
@@ -168,8 +205,8 @@ func (s *Server) StreamEvents(stream grpc.BidiStreamingServer[eventpb.StreamEven
 		staleEventDetectors[i] = ctor()
 	}
 
-	ss := NewProtoEventStream(
-		streamKey,
+	ss := &appInstallStream{ProtoEventStream: NewProtoEventStream(
+		deviceStreamKey,
 		streamBufferSize,
 		func(events []*eventpb.Event) (*eventpb.EventBatch, bool) {
 			if len(events) > maxEventBatchSize {
@@ -207,14 +244,14 @@ func (s *Server) StreamEvents(stream grpc.BidiStreamingServer[eventpb.StreamEven
 			}
 			return &eventpb.EventBatch{Events: eventsToSend}, true
 		},
-	)
+	)}
 
-	s.streams[streamKey] = ss
+	userStreams[appInstallID] = ss
 
-	myStreamMu, ok := s.individualStreamMu[streamKey]
+	myStreamMu, ok := s.individualStreamMu[deviceStreamKey]
 	if !ok {
 		myStreamMu = &sync.Mutex{}
-		s.individualStreamMu[streamKey] = myStreamMu
+		s.individualStreamMu[deviceStreamKey] = myStreamMu
 	}
 
 	s.streamsMu.Unlock()
@@ -229,17 +266,21 @@ func (s *Server) StreamEvents(stream grpc.BidiStreamingServer[eventpb.StreamEven
 		// We check to see if the current active stream is the one that we created.
 		// If it is, we can just remove it since it's closed. Otherwise, we leave it
 		// be, as another StreamEvents() call is handling it.
-		liveStream := s.streams[streamKey]
+		userStreams := s.streams[streamKey]
+		liveStream := userStreams[appInstallID]
 		if liveStream == ss {
-			delete(s.streams, streamKey)
+			delete(userStreams, appInstallID)
+			if len(userStreams) == 0 {
+				delete(s.streams, streamKey)
+			}
 		}
 
 		s.streamsMu.Unlock()
 
 		ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
-		err := s.events.DeleteRendezvous(ctx, streamKey, s.broadcastAddress)
+		err := s.backend.UnregisterStream(ctx, streamKey, appInstallID)
 		if err != nil {
-			log.With(zap.Error(err)).Warn("Failed to cleanup rendezvous record")
+			log.With(zap.Error(err)).Warn("Failed to unregister stream")
 		}
 		cancel()
 
@@ -254,26 +295,63 @@ func (s *Server) StreamEvents(stream grpc.BidiStreamingServer[eventpb.StreamEven
 	default:
 	}
 
-	// Let other RPC servers know where to find the active stream via a rendezvous
-	// record
-	rendezvous := &Rendezvous{
-		Key:       streamKey,
-		Address:   s.broadcastAddress,
-		ExpiresAt: time.Now().Add(rendezvousExpiryTime),
-	}
-	err = s.events.CreateRendezvous(ctx, rendezvous)
+	// Let other RPC servers know events for the stream should be routed here
+	err = s.backend.RegisterStream(ctx, streamKey, appInstallID)
 	if err == ErrRendezvousExists {
 		log.Warn("Existing stream detected on another server aborting")
 		return status.Error(codes.Aborted, "stream already exists")
 	} else if err != nil {
-		log.With(zap.Error(err)).Warn("Failure saving rendezvous record")
-		return status.Error(codes.Internal, "failure saving rendezvous record")
+		log.With(zap.Error(err)).Warn("Failure registering stream")
+		return status.Error(codes.Internal, "failure registering stream")
+	}
+
+	// Replay events missed while the app install had no stream, now that new
+	// events are routed here
+	replayedSequence, replayedEventIDs, err := replayInbox(ctx, log, s.events, streamKey, appInstallID, resumeEventID, ss)
+	if err != nil {
+		return status.Error(codes.Internal, "failure replaying inbox events")
 	}
+	ss.finishReplay(log, replayedEventIDs)
+
+	// Replayed events are sent before the first ping, so the client's pong to it
+	// acknowledges them and the app install's inbox cursor can move past them
+	isReplayAcked := replayedSequence == 0
+	if isReplayAcked {
+		s.acknowledgeReplay(log, streamKey, appInstallID, ss, replayedSequence)
+	} else {
+		for range len(ss.Channel()) {
+			batch, ok := <-ss.Channel()
+			if !ok {
+				log.Debug("Stream closed; ending stream")
+				return status.Error(codes.Aborted, "stream closed")
+			}
 
-	updateRendezvousCh := time.After(rendezvousRefreshInterval)
+			log.Debug("Sending replayed events to client stream")
+			err = stream.Send(&eventpb.StreamEventsResponse{
+				Type: &eventpb.StreamEventsResponse_Events{
+					Events: batch,
+				},
+			})
+			if err != nil {
+				log.Info("Failed to send events to client stream", zap.Error(err))
+				return err
+			}
+		}
+	}
+
+	refreshStreamCh := time.After(rendezvousRefreshInterval)
 	sendPingCh := time.After(0)
+	pongCh := make(chan struct{}, 1)
 	streamHealthCh := protoutil.MonitorStreamHealth(ctx, log, stream, func(t *eventpb.StreamEventsRequest) bool {
-		return t.GetPong() != nil
+		if t.GetPong() == nil {
+			return false
+		}
+
+		select {
+		case pongCh <- struct{}{}:
+		default:
+		}
+		return true
 	})
 
 	for {
@@ -294,21 +372,19 @@ func (s *Server) StreamEvents(stream grpc.BidiStreamingServer[eventpb.StreamEven
 				log.Info("Failed to send events to client stream", zap.Error(err))
 				return err
 			}
-		case <-updateRendezvousCh:
-			log.Debug("Refreshing rendezvous record")
-
-			expiry := time.Now().Add(rendezvousExpiryTime)
+		case <-refreshStreamCh:
+			log.Debug("Refreshing stream registration")
 
-			err = s.events.ExtendRendezvousExpiry(ctx, streamKey, s.broadcastAddress, expiry)
+			err = s.backend.RefreshStream(ctx, streamKey, appInstallID)
 			if err == ErrRendezvousNotFound {
 				log.Warn("Existing stream detected on another server aborting")
 				return status.Error(codes.Aborted, "stream already exists")
 			} else if err != nil {
-				log.With(zap.Error(err)).Warn("Failure extending rendezvous record expiry")
-				return status.Error(codes.Internal, "failure extending rendezvous record expiry")
+				log.With(zap.Error(err)).Warn("Failure refreshing stream registration")
+				return status.Error(codes.Internal, "failure refreshing stream registration")
 			}
 
-			updateRendezvousCh = time.After(rendezvousRefreshInterval)
+			refreshStreamCh = time.After(rendezvousRefreshInterval)
 		case <-sendPingCh:
 			log.Debug("Sending ping to client")
 
@@ -326,6 +402,12 @@ func (s *Server) StreamEvents(stream grpc.BidiStreamingServer[eventpb.StreamEven
 				log.Debug("Stream is unhealthy; aborting")
 				return status.Error(codes.Aborted, "terminating unhealthy stream")
 			}
+		case <-pongCh:
+			if !isReplayAcked {
+				log.Debug("Client acknowledged replayed events")
+				s.acknowledgeReplay(log, streamKey, appInstallID, ss, replayedSequence)
+				isReplayAcked = true
+			}
 		case <-streamHealthCh:
 			log.Debug("Stream is unhealthy; aborting")
 			return status.Error(codes.Aborted, "terminating unhealthy stream")
@@ -346,130 +428,287 @@ func (s *Server) ForwardEvents(ctx context.Context, req *eventpb.ForwardEventsRe
 		return &eventpb.ForwardEventsResponse{Result: eventpb.ForwardEventsResponse_DENIED}, nil
 	}
 
-	for _, event := range req.UserEvents.Events {
-		log := s.log.With(
-			zap.String("event_id", EventIDString(event.Event.Id)),
-			zap.String("user_id", model.UserIDString(event.UserId)),
-		)
+	sequencesHeader, err := codeheaders.GetASCIIHeaderByName(ctx, inboxSequencesHeaderName)
+	if err != nil {
+		s.log.Warn("Failure getting inbox sequences header")
+		return nil, status.Error(codes.Internal, "")
+	}
+	sequences, err := decodeInboxSequences(sequencesHeader, len(req.UserEvents.Events))
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
 
+	events := make([]*ForwardedEvent, len(req.UserEvents.Events))
+	for i, event := range req.UserEvents.Events {
 		switch typed := event.Event.Type.(type) {
 		case *eventpb.Event_Test:
 			typed.Test.Hops = append(typed.Test.Hops, s.broadcastAddress)
 		}
 
-		err = s.ForwardUserEvents(context.Background(), event)
-		if err != nil {
-			log.With(zap.Error(err)).Warn("Failure forwarding user event")
+		// Events from senders that don't send inbox sequences are delivered live
+		// without moving inbox cursors
+		events[i] = &ForwardedEvent{UserEvent: event}
+		if sequences != nil {
+			events[i].Sequence = sequences[i]
 		}
 	}
+
+	// The sender already fanned out to every server hosting one of the users'
+	// streams, so only deliver to the streams hosted here. Undelivered events
+	// are already in their users' inboxes.
+	_, err = s.localStreams.Deliver(ctx, s.broadcastAddress, events)
+	if err != nil {
+		s.log.With(zap.Error(err)).Warn("Failure delivering forwarded user events")
+		return nil, status.Error(codes.Internal, "")
+	}
 	return &eventpb.ForwardEventsResponse{}, nil
 }
 
-// todo: duplicated code with ForwardingClient
-// todo: utilize batching by receiver to optimize internal forwarding RPC calls
-func (s *Server) ForwardUserEvents(ctx context.Context, events ...*eventpb.UserEvent) error {
-	var err error
-	if !codeheaders.AreHeadersInitialized(ctx) {
-		ctx, err = codeheaders.ContextWithHeaders(ctx)
-		if err != nil {
-			s.log.With(zap.Error(err)).Warn("Failure initializing headers")
-			return err
-		}
+// getResumeEventID gets the ID of the last event the client received, or nil
+// if the client isn't resuming
+func getResumeEventID(ctx context.Context) (*eventpb.EventId, error) {
+	headerValue, err := codeheaders.GetASCIIHeaderByName(ctx, resumeEventIDHeaderName)
+	if err != nil {
+		return nil, err
+	}
+	if len(headerValue) == 0 {
+		return nil, nil
 	}
 
-	err = codeheaders.SetASCIIHeader(ctx, internalRpcApiKeyHeaderName, s.currentRpcApiKey)
+	id, err := uuid.Parse(headerValue)
 	if err != nil {
-		s.log.With(zap.Error(err)).Warn("Failure setting RPC API key header")
-		return err
+		return nil, err
 	}
+	return &eventpb.EventId{Id: id[:]}, nil
+}
 
-	for _, event := range events {
-		go func() {
-			coderetry.Retry(
-				func() error {
-					return s.forwardUserEvent(ctx, event)
-				},
-				coderetry.Limit(3),
-				coderetry.Backoff(codebackoff.BinaryExponential(100*time.Millisecond), 500*time.Millisecond),
-			)
-		}()
+// acknowledgeReplay moves the app install's inbox cursor past the events
+// replayed to its stream, and any inbox events delivered to it in the meantime
+func (s *Server) acknowledgeReplay(log *zap.Logger, streamKey, appInstallID string, ss *appInstallStream, replayedSequence uint64) {
+	sequence := ss.acknowledgeReplay(replayedSequence)
+	if sequence == 0 {
+		return
 	}
-	return nil
-}
 
-// todo: duplicated code with ForwardingClient
-func (s *Server) forwardUserEvent(ctx context.Context, event *eventpb.UserEvent) error {
-	log := s.log.With(
-		zap.String("event_id", EventIDString(event.Event.Id)),
-		zap.String("user_id", model.UserIDString(event.UserId)),
-	)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
 
-	streamKey := model.UserIDString(event.UserId)
+	err := s.events.AdvanceInboxCursor(ctx, streamKey, appInstallID, sequence)
+	if err != nil {
+		log.With(zap.Error(err)).Warn("Failure advancing inbox cursor")
+	}
+}
 
-	rendezvous, err := s.events.GetRendezvous(ctx, streamKey)
-	switch err {
-	case nil:
-		log = log.With(zap.String("receiver_address", rendezvous.Address))
+// advanceInboxCursors moves app installs' inbox cursors past the events
+// delivered live to their streams
+func (s *Server) advanceInboxCursors(cursors map[inboxCursorKey]uint64) {
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
 
-		// Expired rendezvous record that likely wasn't cleaned up. Avoid forwarding,
-		// since we expect a broken state.
-		if time.Since(rendezvous.ExpiresAt) >= 0 {
-			log.With(zap.Error(err)).Debug("Dropping event with expired rendezvous record")
-			return nil
+	for cursorKey, sequence := range cursors {
+		err := s.events.AdvanceInboxCursor(ctx, cursorKey.key, cursorKey.appInstallID, sequence)
+		if err != nil {
+			s.log.With(
+				zap.Error(err),
+				zap.String("user_id", cursorKey.key),
+				zap.String("app_install_id", cursorKey.appInstallID),
+			).Warn("Failure advancing inbox cursor")
 		}
+	}
+}
 
-		// This server is hosting the user's event stream, no forwarding required
-		if rendezvous.Address == s.broadcastAddress {
-			s.streamsMu.RLock()
-			stream, exists := s.streams[streamKey]
-			s.streamsMu.RUnlock()
+func (s *Server) ForwardUserEvents(ctx context.Context, events ...*eventpb.UserEvent) error {
+	return s.backend.ForwardUserEvents(ctx, events...)
+}
 
-			if exists {
-				cloned := proto.Clone(event.Event).(*eventpb.Event)
-				if err := stream.Notify([]*eventpb.Event{cloned}, streamTimeout); err != nil {
-					log.Warn("Failed to notify event on local stream", zap.Error(err))
-				}
-			}
+func (s *Server) OnEvent(userID *commonpb.UserId, e *eventpb.Event) {
+	s.ForwardUserEvents(context.Background(), &eventpb.UserEvent{UserId: userID, Event: e})
+}
+
+// appInstallStream is an app install's stream hosted by this server
+type appInstallStream struct {
+	*ProtoEventStream[[]*eventpb.Event, *eventpb.EventBatch]
 
-			return nil
+	mu               sync.Mutex
+	isReplayed       bool
+	replayedEventIDs map[string]struct{}
+	pendingLive      []*InboxEvent // Live inbox events received during the replay
+	isReplayAcked    bool
+	unackedSequence  uint64 // Latest inbox event delivered before the replay was acknowledged
+}
+
+// deliverInboxEvents notifies the stream of live inbox events, in sequence
+// order, and returns the sequence the app install's inbox cursor can move to,
+// or zero if it can't move. Events received during the replay are held until
+// it finishes, so they're only notified if they weren't replayed. Events
+// without an inbox sequence are notified, but don't move the cursor. Until the
+// client acknowledges the replay, the cursor is held back so unacknowledged
+// replayed events aren't skipped.
+func (s *appInstallStream) deliverInboxEvents(inboxEvents []*InboxEvent) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.isReplayed {
+		s.pendingLive = append(s.pendingLive, inboxEvents...)
+		return 0, nil
+	}
+	return s.notifyInboxEventsLocked(inboxEvents)
+}
+
+func (s *appInstallStream) notifyInboxEventsLocked(inboxEvents []*InboxEvent) (uint64, error) {
+	var batch []*eventpb.Event
+	var sequence uint64
+	for _, inboxEvent := range inboxEvents {
+		// The stream already received the event in the replay. Events are matched
+		// by ID, since a live event can have an earlier sequence than the last
+		// replayed event when it's added to the inbox concurrently.
+		if _, ok := s.replayedEventIDs[string(inboxEvent.Event.Id.GetId())]; ok {
+			continue
 		}
 
-		// Otherwise, forward it to the server hosting the user's stream
-		forwardingRpcClient, err := getForwardingRpcClient(rendezvous.Address)
-		if err != nil {
-			log.With(zap.Error(err)).Warn("Failure creating forwarding RPC client")
-			return err
+		batch = append(batch, proto.Clone(inboxEvent.Event).(*eventpb.Event))
+		sequence = max(sequence, inboxEvent.Sequence)
+	}
+
+	if len(batch) == 0 {
+		return 0, nil
+	}
+
+	if err := s.Notify(batch, streamTimeout); err != nil {
+		return 0, err
+	}
+
+	if s.isReplayAcked {
+		return sequence, nil
+	}
+	s.unackedSequence = max(s.unackedSequence, sequence)
+	return 0, nil
+}
+
+// finishReplay notifies the stream of the live inbox events received during
+// the replay that weren't replayed
+func (s *appInstallStream) finishReplay(log *zap.Logger, replayedEventIDs map[string]struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.isReplayed = true
+	s.replayedEventIDs = replayedEventIDs
+
+	pendingLive := s.pendingLive
+	s.pendingLive = nil
+	for start := 0; start < len(pendingLive); start += maxEventBatchSize {
+		end := min(start+maxEventBatchSize, len(pendingLive))
+		if _, err := s.notifyInboxEventsLocked(pendingLive[start:end]); err != nil {
+			log.With(zap.Error(err)).Warn("Failed to notify events on local stream")
 		}
+	}
+}
 
-		ctx, cancel := context.WithTimeout(ctx, forwardRpcTimeout)
-		defer cancel()
+// acknowledgeReplay returns the sequence the app install's inbox cursor can
+// move to, now that the client has acknowledged the replay
+func (s *appInstallStream) acknowledgeReplay(replayedSequence uint64) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-		log.Debug("Forwarding events over RPC")
+	s.isReplayAcked = true
+	return max(s.unackedSequence, replayedSequence)
+}
 
-		resp, err := forwardingRpcClient.ForwardEvents(ctx, &eventpb.ForwardEventsRequest{
-			UserEvents: &eventpb.UserEventBatch{
-				Events: []*eventpb.UserEvent{event},
-			},
-		})
-		if err != nil {
-			log.With(zap.Error(err)).Warn("Failure forwarding event over RPC")
-			return err
-		} else if resp.Result != eventpb.ForwardEventsResponse_OK {
-			log.With(zap.String("result", resp.Result.String())).Warn("Failure forwarding event over RPC")
-			return errors.Errorf("rpc forward result %s", resp.Result)
+// localStreamTransport delivers events to the streams hosted by this server
+type localStreamTransport struct {
+	s *Server
+}
+
+type inboxCursorKey struct {
+	key          string
+	appInstallID string
+}
+
+func (t *localStreamTransport) DeliverInboxEvent(_ context.Context, inboxEvent *InboxEvent) ([]string, error) {
+	var appInstallIDs []string
+	cursors, _ := t.deliverInboxEvents(inboxEvent.Key, []*InboxEvent{inboxEvent})
+	for cursorKey := range cursors {
+		appInstallIDs = append(appInstallIDs, cursorKey.appInstallID)
+	}
+	return appInstallIDs, nil
+}
+
+// Deliver delivers forwarded events to the streams hosted by this server as
+// inbox events, so streams skip the events they already replayed. The inbox
+// cursors of the app installs that got the events are moved past them, and
+// the user's other app installs replay them from the inbox. Events are only
+// undelivered when none of the user's streams here could be notified.
+func (t *localStreamTransport) Deliver(_ context.Context, _ string, events []*ForwardedEvent) ([]*ForwardedEvent, error) {
+	var streamKeys []string
+	eventsByStreamKey := make(map[string][]*ForwardedEvent)
+	for _, event := range events {
+		streamKey := model.UserIDString(event.UserEvent.UserId)
+		if _, ok := eventsByStreamKey[streamKey]; !ok {
+			streamKeys = append(streamKeys, streamKey)
+		}
+		eventsByStreamKey[streamKey] = append(eventsByStreamKey[streamKey], event)
+	}
+
+	var undelivered []*ForwardedEvent
+	cursors := make(map[inboxCursorKey]uint64)
+	for _, streamKey := range streamKeys {
+		userEvents := eventsByStreamKey[streamKey]
+
+		inboxEvents := make([]*InboxEvent, len(userEvents))
+		for i, event := range userEvents {
+			inboxEvents[i] = &InboxEvent{
+				Key:      streamKey,
+				Sequence: event.Sequence,
+				Event:    event.UserEvent.Event,
+			}
 		}
 
-	case ErrRendezvousNotFound:
-		log.Debug("Dropping event without rendezvous record")
+		userCursors, isDelivered := t.deliverInboxEvents(streamKey, inboxEvents)
+		if !isDelivered {
+			undelivered = append(undelivered, userEvents...)
+		}
+		for cursorKey, sequence := range userCursors {
+			cursors[cursorKey] = sequence
+		}
+	}
 
-	default:
-		log.With(zap.Error(err)).Warn("Failed to get rendezvous record")
-		return err
+	// Cursors are moved in the background, since an app install whose cursor
+	// isn't moved only replays events it already received
+	if len(cursors) > 0 {
+		go t.s.advanceInboxCursors(cursors)
 	}
 
-	return nil
+	return undelivered, nil
 }
 
-func (s *Server) OnEvent(userID *commonpb.UserId, e *eventpb.Event) {
-	s.ForwardUserEvents(context.Background(), &eventpb.UserEvent{UserId: userID, Event: e})
+// deliverInboxEvents fans out a user's inbox events to each of their app
+// installs streaming from this server. The sequences their inbox cursors can
+// move to are returned, along with whether any of the streams were notified.
+func (t *localStreamTransport) deliverInboxEvents(streamKey string, inboxEvents []*InboxEvent) (map[inboxCursorKey]uint64, bool) {
+	t.s.streamsMu.RLock()
+	streams := make(map[string]*appInstallStream)
+	for appInstallID, stream := range t.s.streams[streamKey] {
+		streams[appInstallID] = stream
+	}
+	t.s.streamsMu.RUnlock()
+
+	var isDelivered bool
+	cursors := make(map[inboxCursorKey]uint64)
+	for appInstallID, stream := range streams {
+		sequence, err := stream.deliverInboxEvents(inboxEvents)
+		if err != nil {
+			t.s.log.With(
+				zap.Error(err),
+				zap.String("user_id", streamKey),
+				zap.String("app_install_id", appInstallID),
+			).Warn("Failed to notify events on local stream")
+			continue
+		}
+		isDelivered = true
+
+		if sequence > 0 {
+			cursors[inboxCursorKey{key: streamKey, appInstallID: appInstallID}] = sequence
+		}
+	}
+	return cursors, isDelivered
 }
@@ -7,20 +7,61 @@ import (
 )
 
 var (
-	ErrRendezvousExists   = errors.New("rendezvous already exists")
-	ErrRendezvousNotFound = errors.New("rendezvous not found")
+	ErrRendezvousExists    = errors.New("rendezvous already exists")
+	ErrRendezvousNotFound  = errors.New("rendezvous not found")
+	ErrInboxEventNotFound  = errors.New("inbox event not found")
+	ErrInboxCursorNotFound = errors.New("inbox cursor not found")
 )
 
 type Store interface {
-	// CreateRendezvous creates a new rendezvous for an event stream
+	// CreateRendezvous creates a new rendezvous for an app install's event stream
 	CreateRendezvous(ctx context.Context, rendezvous *Rendezvous) error
 
-	// GetRendezvous gets an event stream rendezvous for a given key
-	GetRendezvous(ctx context.Context, key string) (*Rendezvous, error)
+	// GetRendezvous gets an event stream rendezvous for a given key and app install
+	GetRendezvous(ctx context.Context, key, appInstallID string) (*Rendezvous, error)
 
-	// ExtendRendezvousxpiry extends a rendezvous' expiry for a given key and address
-	ExtendRendezvousExpiry(ctx context.Context, key, address string, expiresAt time.Time) error
+	// GetRendezvousBatch gets the unexpired event stream rendezvous for a batch
+	// of keys, across all of their app installs. Keys without a rendezvous are
+	// omitted from the result.
+	GetRendezvousBatch(ctx context.Context, keys ...string) ([]*Rendezvous, error)
 
-	// DeleteRendezvous deletes an event stream rendezvous for a given key and address
-	DeleteRendezvous(ctx context.Context, key, address string) error
+	// ExtendRendezvousxpiry extends a rendezvous' expiry for a given key, app install and address
+	ExtendRendezvousExpiry(ctx context.Context, key, appInstallID, address string, expiresAt time.Time) error
+
+	// DeleteRendezvous deletes an event stream rendezvous for a given key, app install and address
+	DeleteRendezvous(ctx context.Context, key, appInstallID, address string) error
+
+	// AddInboxEvents adds a batch of events to their users' inboxes. Each event's
+	// sequence is assigned by the store, increasing in the order provided.
+	AddInboxEvents(ctx context.Context, events ...*InboxEvent) error
+
+	// GetInboxEvents gets up to limit unexpired events in a user's inbox with a
+	// sequence after the cursor, in sequence order
+	GetInboxEvents(ctx context.Context, key string, cursor uint64, limit int) ([]*InboxEvent, error)
+
+	// DeleteExpiredInboxEvents deletes the expired events in a user's inbox.
+	// Unexpired events are kept, since each of the user's app installs reads the
+	// inbox from its own cursor.
+	DeleteExpiredInboxEvents(ctx context.Context, key string) error
+
+	// DeleteAllExpiredInboxEvents deletes the expired events in every user's inbox
+	DeleteAllExpiredInboxEvents(ctx context.Context) error
+
+	// GetInboxSequenceAddedBefore gets the sequence of the latest event added to
+	// a user's inbox before the provided time, or zero if there isn't one
+	GetInboxSequenceAddedBefore(ctx context.Context, key string, addedBefore time.Time) (uint64, error)
+
+	// GetInboxCursor gets the sequence of the last inbox event delivered to an
+	// app install. ErrInboxCursorNotFound is returned for app installs that have
+	// never opened a stream.
+	GetInboxCursor(ctx context.Context, key, appInstallID string) (uint64, error)
+
+	// AdvanceInboxCursor moves an app install's inbox cursor forward to the
+	// sequence. The cursor never moves backwards.
+	AdvanceInboxCursor(ctx context.Context, key, appInstallID string, sequence uint64) error
+
+	// DeleteStaleInboxCursors deletes the inbox cursors that haven't moved since
+	// the provided time, across every user. Cursors with unexpired inbox events
+	// after them are kept, since their app installs still need to replay them.
+	DeleteStaleInboxCursors(ctx context.Context, movedBefore time.Time) error
 }
@@ -0,0 +1,52 @@
+package event
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// InboxSweeper is a background worker that deletes the expired events in every
+// user's inbox, which are otherwise only deleted as the user's streams open. It
+// also deletes the inbox cursors that haven't moved for longer than events are
+// kept, once there are no unexpired events after them. Their app installs start
+// over like new ones without missing any events.
+type InboxSweeper struct {
+	log *zap.Logger
+
+	events Store
+}
+
+func NewInboxSweeper(log *zap.Logger, events Store) *InboxSweeper {
+	return &InboxSweeper{
+		log: log,
+
+		events: events,
+	}
+}
+
+// Start runs the sweeper until the provided context is cancelled
+func (s *InboxSweeper) Start(ctx context.Context, interval time.Duration) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+
+		err := s.sweep(ctx)
+		if err != nil {
+			s.log.With(zap.Error(err)).Warn("Failure sweeping inboxes")
+		}
+	}
+}
+
+func (s *InboxSweeper) sweep(ctx context.Context) error {
+	err := s.events.DeleteAllExpiredInboxEvents(ctx)
+	if err != nil {
+		return err
+	}
+
+	return s.events.DeleteStaleInboxCursors(ctx, time.Now().Add(-InboxEventExpiryTime))
+}
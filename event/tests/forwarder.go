@@ -0,0 +1,418 @@
+package tests
+
+import (
+	"context"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	commonpb "github.com/code-payments/flipcash-protobuf-api/generated/go/common/v1"
+	eventpb "github.com/code-payments/flipcash-protobuf-api/generated/go/event/v1"
+
+	coderetry "github.com/code-payments/code-server/pkg/retry"
+	"github.com/code-payments/flipcash-server/event"
+	"github.com/code-payments/flipcash-server/model"
+	"github.com/code-payments/flipcash-server/protoutil"
+)
+
+func RunForwarderTests(t *testing.T, events event.Store, teardown func()) {
+	for _, tf := range []func(t *testing.T, events event.Store){
+		testForwarder_BatchesByReceiverAddress,
+		testForwarder_RetriesFailedDelivery,
+		testForwarder_InboxesEveryEvent,
+		testForwarder_StalledAddressDoesntDelayOthers,
+		testForwarder_InboxesEventsBeyondQueueCap,
+	} {
+		tf(t, events)
+		teardown()
+	}
+}
+
+func testForwarder_BatchesByReceiverAddress(t *testing.T, events event.Store) {
+	transport := event.NewInMemoryTransport()
+	transport.Register("server1", nil)
+	transport.Register("server2", nil)
+
+	metrics := &testForwarderMetrics{}
+	forwarder := newTestForwarder(t, events, transport, metrics, coderetry.Limit(1))
+
+	var userIDs []*commonpb.UserId
+	addressByUser := make(map[string]string)
+	for i := range 10 {
+		userID := model.MustGenerateUserID()
+		address := "server1"
+		if i%2 == 0 {
+			address = "server2"
+		}
+		createTestRendezvous(t, events, userID, address)
+
+		userIDs = append(userIDs, userID)
+		addressByUser[model.UserIDString(userID)] = address
+	}
+
+	var expected []*eventpb.UserEvent
+	for range 20 {
+		for _, userID := range userIDs {
+			userEvent := &eventpb.UserEvent{UserId: userID, Event: newTestEvent()}
+			require.NoError(t, forwarder.ForwardUserEvents(context.Background(), userEvent))
+			expected = append(expected, userEvent)
+		}
+	}
+
+	require.Eventually(t, func() bool {
+		return metrics.getNumDelivered() == len(expected)
+	}, time.Second, 10*time.Millisecond)
+
+	// Every event is delivered to its user's receiver, in order for each user,
+	// in far fewer batches than events
+	for _, address := range []string{"server1", "server2"} {
+		require.Less(t, len(transport.GetDelivered(address)), len(expected)/2)
+
+		actual := getDeliveredUserEvents(transport, address)
+
+		var expectedForAddress []*eventpb.UserEvent
+		for _, userEvent := range expected {
+			if addressByUser[model.UserIDString(userEvent.UserId)] == address {
+				expectedForAddress = append(expectedForAddress, userEvent)
+			}
+		}
+		assertEquivalentUserEvents(t, expectedForAddress, actual)
+	}
+
+	// Every event is added to its user's inbox before it's delivered, and is
+	// delivered with its inbox sequence
+	require.Equal(t, len(expected), metrics.getNumInboxed())
+	for _, address := range []string{"server1", "server2"} {
+		for _, batch := range transport.GetDelivered(address) {
+			for _, forwarded := range batch {
+				inboxEvents, err := events.GetInboxEvents(context.Background(), model.UserIDString(forwarded.UserEvent.UserId), forwarded.Sequence-1, 1)
+				require.NoError(t, err)
+				require.Equal(t, forwarded.Sequence, inboxEvents[0].Sequence)
+				require.NoError(t, protoutil.ProtoEqualError(forwarded.UserEvent.Event, inboxEvents[0].Event))
+			}
+		}
+	}
+}
+
+func testForwarder_RetriesFailedDelivery(t *testing.T, events event.Store) {
+	transport := event.NewInMemoryTransport()
+	transport.Register("server1", nil)
+
+	metrics := &testForwarderMetrics{}
+	forwarder := newTestForwarder(t, events, transport, metrics, coderetry.Limit(3))
+
+	userID := model.MustGenerateUserID()
+	createTestRendezvous(t, events, userID, "server1")
+
+	// Recovers within the retry limit
+	transport.FailNext("server1", 2)
+
+	userEvent := &eventpb.UserEvent{UserId: userID, Event: newTestEvent()}
+	require.NoError(t, forwarder.ForwardUserEvents(context.Background(), userEvent))
+
+	require.Eventually(t, func() bool {
+		return metrics.getNumDelivered() == 1
+	}, time.Second, 10*time.Millisecond)
+	assertEquivalentUserEvents(t, []*eventpb.UserEvent{userEvent}, getDeliveredUserEvents(transport, "server1"))
+
+	// Exceeds the retry limit, so the event is only kept in the user's inbox
+	transport.FailNext("server1", 3)
+
+	failedEvent := &eventpb.UserEvent{UserId: userID, Event: newTestEvent()}
+	require.NoError(t, forwarder.ForwardUserEvents(context.Background(), failedEvent))
+
+	require.Eventually(t, func() bool {
+		return metrics.getNumFailed() == 1
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, 1, metrics.getNumDelivered())
+	require.Equal(t, 2, metrics.getNumInboxed())
+
+	inboxEvents, err := events.GetInboxEvents(context.Background(), model.UserIDString(userID), 0, 10)
+	require.NoError(t, err)
+	require.Len(t, inboxEvents, 2)
+	require.NoError(t, protoutil.ProtoEqualError(userEvent.Event, inboxEvents[0].Event))
+	require.NoError(t, protoutil.ProtoEqualError(failedEvent.Event, inboxEvents[1].Event))
+}
+
+func testForwarder_InboxesEveryEvent(t *testing.T, events event.Store) {
+	transport := event.NewInMemoryTransport()
+	transport.Register("server1", &rejectingTransport{})
+
+	metrics := &testForwarderMetrics{}
+	forwarder := newTestForwarder(t, events, transport, metrics, coderetry.Limit(3))
+
+	// Without a rendezvous
+	withoutRendezvous := model.MustGenerateUserID()
+
+	// With a rendezvous, but the receiver no longer hosts the stream
+	withRendezvous := model.MustGenerateUserID()
+	createTestRendezvous(t, events, withRendezvous, "server1")
+
+	for _, userID := range []*commonpb.UserId{withoutRendezvous, withRendezvous} {
+		userEvent := &eventpb.UserEvent{UserId: userID, Event: newTestEvent()}
+		require.NoError(t, forwarder.ForwardUserEvents(context.Background(), userEvent))
+
+		require.Eventually(t, func() bool {
+			inboxEvents, err := events.GetInboxEvents(context.Background(), model.UserIDString(userID), 0, 10)
+			return err == nil && len(inboxEvents) == 1
+		}, time.Second, 10*time.Millisecond)
+	}
+
+	// Rejected events aren't retried
+	require.Len(t, transport.GetDelivered("server1"), 1)
+	require.Zero(t, metrics.getNumFailed())
+	require.Equal(t, 2, metrics.getNumInboxed())
+}
+
+func testForwarder_StalledAddressDoesntDelayOthers(t *testing.T, events event.Store) {
+	stalled := newBlockingTransport()
+	defer stalled.unblock()
+
+	transport := event.NewInMemoryTransport()
+	transport.Register("server1", stalled)
+	transport.Register("server2", nil)
+
+	metrics := &testForwarderMetrics{}
+	forwarder := newTestForwarder(t, events, transport, metrics, coderetry.Limit(1))
+
+	stalledUser := model.MustGenerateUserID()
+	createTestRendezvous(t, events, stalledUser, "server1")
+	healthyUser := model.MustGenerateUserID()
+	createTestRendezvous(t, events, healthyUser, "server2")
+
+	stalledEvent := &eventpb.UserEvent{UserId: stalledUser, Event: newTestEvent()}
+	require.NoError(t, forwarder.ForwardUserEvents(context.Background(), stalledEvent))
+	stalled.waitForDelivery(t)
+
+	// Later flushes, and other addresses, aren't held up by the stalled delivery
+	var expected []*eventpb.UserEvent
+	for range 3 {
+		userEvent := &eventpb.UserEvent{UserId: healthyUser, Event: newTestEvent()}
+		require.NoError(t, forwarder.ForwardUserEvents(context.Background(), userEvent))
+		expected = append(expected, userEvent)
+
+		require.Eventually(t, func() bool {
+			return metrics.getNumDelivered() == len(expected)
+		}, time.Second, 10*time.Millisecond)
+	}
+
+	assertEquivalentUserEvents(t, expected, getDeliveredUserEvents(transport, "server2"))
+
+	stalled.unblock()
+
+	require.Eventually(t, func() bool {
+		return metrics.getNumDelivered() == len(expected)+1
+	}, time.Second, 10*time.Millisecond)
+	assertEquivalentUserEvents(t, []*eventpb.UserEvent{stalledEvent}, getDeliveredUserEvents(transport, "server1"))
+	require.Zero(t, metrics.getNumFailed())
+}
+
+func testForwarder_InboxesEventsBeyondQueueCap(t *testing.T, events event.Store) {
+	stalled := newBlockingTransport()
+	defer stalled.unblock()
+
+	transport := event.NewInMemoryTransport()
+	transport.Register("server1", stalled)
+
+	metrics := &testForwarderMetrics{}
+	forwarder := event.NewBatchingForwarder(
+		zaptest.NewLogger(t),
+		events,
+		transport,
+		event.ForwarderConfig{
+			BatchWindow:     10 * time.Millisecond,
+			RetryStrategies: []coderetry.Strategy{coderetry.Limit(1)},
+			MaxQueuedEvents: 2,
+			Metrics:         metrics,
+		},
+	)
+
+	userID := model.MustGenerateUserID()
+	createTestRendezvous(t, events, userID, "server1")
+
+	first := &eventpb.UserEvent{UserId: userID, Event: newTestEvent()}
+	require.NoError(t, forwarder.ForwardUserEvents(context.Background(), first))
+	stalled.waitForDelivery(t)
+
+	// Only the first two events fit in the queue while the first is delivered
+	var queued, overflow []*eventpb.UserEvent
+	for i := range 5 {
+		userEvent := &eventpb.UserEvent{UserId: userID, Event: newTestEvent()}
+		if i < 2 {
+			queued = append(queued, userEvent)
+		} else {
+			overflow = append(overflow, userEvent)
+		}
+	}
+	require.NoError(t, forwarder.ForwardUserEvents(context.Background(), append(queued, overflow...)...))
+
+	// Every event is kept in the user's inbox, including the overflow
+	require.Eventually(t, func() bool {
+		return metrics.getNumInboxed() == 1+len(queued)+len(overflow)
+	}, time.Second, 10*time.Millisecond)
+
+	stalled.unblock()
+
+	require.Eventually(t, func() bool {
+		return metrics.getNumDelivered() == 1+len(queued)
+	}, time.Second, 10*time.Millisecond)
+
+	// Only the events that fit in the queue are delivered
+	assertEquivalentUserEvents(t, append([]*eventpb.UserEvent{first}, queued...), getDeliveredUserEvents(transport, "server1"))
+
+	inboxEvents, err := events.GetInboxEvents(context.Background(), model.UserIDString(userID), 0, 10)
+	require.NoError(t, err)
+	require.Len(t, inboxEvents, 1+len(queued)+len(overflow))
+	for _, userEvent := range append(queued, overflow...) {
+		require.True(t, slices.ContainsFunc(inboxEvents, func(inboxEvent *event.InboxEvent) bool {
+			return protoutil.ProtoEqualError(userEvent.Event, inboxEvent.Event) == nil
+		}))
+	}
+}
+
+func newTestForwarder(t *testing.T, events event.Store, transport event.Transport, metrics event.ForwarderMetrics, retryStrategies ...coderetry.Strategy) event.Forwarder {
+	return event.NewBatchingForwarder(
+		zaptest.NewLogger(t),
+		events,
+		transport,
+		event.ForwarderConfig{
+			BatchWindow:     10 * time.Millisecond,
+			RetryStrategies: retryStrategies,
+			Metrics:         metrics,
+		},
+	)
+}
+
+func createTestRendezvous(t *testing.T, events event.Store, userID *commonpb.UserId, address string) {
+	require.NoError(t, events.CreateRendezvous(context.Background(), &event.Rendezvous{
+		Key:       model.UserIDString(userID),
+		Address:   address,
+		ExpiresAt: time.Now().Add(time.Minute),
+	}))
+}
+
+func newTestEvent() *eventpb.Event {
+	return &eventpb.Event{
+		Id: event.MustGenerateEventID(),
+		Ts: timestamppb.Now(),
+		Type: &eventpb.Event_Test{
+			Test: &eventpb.TestEvent{
+				Nonce: uint64(rand.Int64()),
+			},
+		},
+	}
+}
+
+// getDeliveredUserEvents gets the user events delivered to the address, in
+// delivery order
+func getDeliveredUserEvents(transport *event.InMemoryTransport, address string) []*eventpb.UserEvent {
+	var res []*eventpb.UserEvent
+	for _, batch := range transport.GetDelivered(address) {
+		for _, forwarded := range batch {
+			res = append(res, forwarded.UserEvent)
+		}
+	}
+	return res
+}
+
+func assertEquivalentUserEvents(t *testing.T, expected, actual []*eventpb.UserEvent) {
+	require.Len(t, actual, len(expected))
+	for i := range expected {
+		require.NoError(t, protoutil.ProtoEqualError(expected[i], actual[i]))
+	}
+}
+
+type rejectingTransport struct{}
+
+func (t *rejectingTransport) Deliver(_ context.Context, _ string, events []*event.ForwardedEvent) ([]*event.ForwardedEvent, error) {
+	return events, nil
+}
+
+// blockingTransport accepts every event, but blocks deliveries until unblocked
+type blockingTransport struct {
+	delivering chan struct{}
+	unblocked  chan struct{}
+	once       sync.Once
+}
+
+func newBlockingTransport() *blockingTransport {
+	return &blockingTransport{
+		delivering: make(chan struct{}, 1),
+		unblocked:  make(chan struct{}),
+	}
+}
+
+func (t *blockingTransport) Deliver(ctx context.Context, _ string, _ []*event.ForwardedEvent) ([]*event.ForwardedEvent, error) {
+	select {
+	case t.delivering <- struct{}{}:
+	default:
+	}
+
+	select {
+	case <-t.unblocked:
+		return nil, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (t *blockingTransport) waitForDelivery(tb testing.TB) {
+	select {
+	case <-t.delivering:
+	case <-time.After(time.Second):
+		require.Fail(tb, "timed out waiting for delivery")
+	}
+}
+
+func (t *blockingTransport) unblock() {
+	t.once.Do(func() { close(t.unblocked) })
+}
+
+type testForwarderMetrics struct {
+	mu           sync.Mutex
+	numDelivered int
+	numFailed    int
+	numInboxed   int
+}
+
+func (m *testForwarderMetrics) OnEventsDelivered(_ string, numEvents int, _ time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.numDelivered += numEvents
+}
+
+func (m *testForwarderMetrics) OnDeliveryFailed(_ string, numEvents int, _ error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.numFailed += numEvents
+}
+
+func (m *testForwarderMetrics) OnEventsInboxed(numEvents int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.numInboxed += numEvents
+}
+
+func (m *testForwarderMetrics) getNumDelivered() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.numDelivered
+}
+
+func (m *testForwarderMetrics) getNumFailed() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.numFailed
+}
+
+func (m *testForwarderMetrics) getNumInboxed() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.numInboxed
+}
@@ -8,9 +8,11 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
 	"go.uber.org/zap/zaptest"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/timestamppb"
@@ -26,21 +28,68 @@ import (
 	"github.com/code-payments/flipcash-server/protoutil"
 )
 
+// BackendFactory creates the stream backend constructor for a test server
+type BackendFactory func(log *zap.Logger, events event.Store, broadcastAddress, internalRpcApiKey string) event.StreamBackendCtor
+
+// NewRendezvousBackendFactory creates test servers with the rendezvous backend
+func NewRendezvousBackendFactory() BackendFactory {
+	return func(log *zap.Logger, events event.Store, broadcastAddress, internalRpcApiKey string) event.StreamBackendCtor {
+		return event.NewRendezvousBackend(log, events, broadcastAddress, internalRpcApiKey, event.DefaultForwarderConfig)
+	}
+}
+
 func RunServerTests(t *testing.T, accounts account.Store, events event.Store, teardown func()) {
-	for _, tf := range []func(t *testing.T, accounts account.Store, events event.Store){
+	newBackend := NewRendezvousBackendFactory()
+	for _, tf := range []func(t *testing.T, accounts account.Store, events event.Store, newBackend BackendFactory){
 		testSingleServerHappyPath,
 		testMultiServerHappyPath,
 		testMultipleOpenStreams,
 		testKeepAlive,
 		testRendezvousRecord,
 	} {
-		tf(t, accounts, events)
+		tf(t, accounts, events, newBackend)
+		teardown()
+	}
+}
+
+// RunDeliveryServerTests runs the server tests for how events reach streams
+// with the rendezvous backend. They're run apart from RunServerTests, so they
+// don't depend on its stream takeover tests passing.
+func RunDeliveryServerTests(t *testing.T, accounts account.Store, events event.Store, teardown func()) {
+	newBackend := NewRendezvousBackendFactory()
+	for _, tf := range []func(t *testing.T, accounts account.Store, events event.Store, newBackend BackendFactory){
+		testInboxReplay,
+		testBatchedForwarding,
+		testInboxReplayPerAppInstall,
+		testMultipleAppInstalls,
+		testInboxReplaySkipsReplayedLiveEvents,
+		testInboxReplayResumesFromClientEvent,
+		testInboxReplayNewAppInstall,
+		testForwardEventsWithoutInboxSequences,
+	} {
+		tf(t, accounts, events, newBackend)
 		teardown()
 	}
 }
 
-func testSingleServerHappyPath(t *testing.T, accounts account.Store, events event.Store) {
-	testEnv, cleanup := setupTest(t, accounts, events, false)
+// RunStreamBackendTests runs the server tests that don't depend on how the
+// stream backend routes events between servers
+func RunStreamBackendTests(t *testing.T, accounts account.Store, events event.Store, newBackend BackendFactory, teardown func()) {
+	for _, tf := range []func(t *testing.T, accounts account.Store, events event.Store, newBackend BackendFactory){
+		testSingleServerHappyPath,
+		testMultiServerHappyPath,
+		testKeepAlive,
+		testInboxReplay,
+		testInboxReplayPerAppInstall,
+		testInboxReplaySkipsReplayedLiveEvents,
+	} {
+		tf(t, accounts, events, newBackend)
+		teardown()
+	}
+}
+
+func testSingleServerHappyPath(t *testing.T, accounts account.Store, events event.Store, newBackend BackendFactory) {
+	testEnv, cleanup := setupTest(t, accounts, events, newBackend, false)
 	defer cleanup()
 
 	userID := model.MustGenerateUserID()
@@ -62,8 +111,8 @@ func testSingleServerHappyPath(t *testing.T, accounts account.Store, events even
 	}
 }
 
-func testMultiServerHappyPath(t *testing.T, accounts account.Store, events event.Store) {
-	testEnv, cleanup := setupTest(t, accounts, events, true)
+func testMultiServerHappyPath(t *testing.T, accounts account.Store, events event.Store, newBackend BackendFactory) {
+	testEnv, cleanup := setupTest(t, accounts, events, newBackend, true)
 	defer cleanup()
 
 	userID := model.MustGenerateUserID()
@@ -89,10 +138,10 @@ func testMultiServerHappyPath(t *testing.T, accounts account.Store, events event
 	}
 }
 
-func testMultipleOpenStreams(t *testing.T, accounts account.Store, events event.Store) {
+func testMultipleOpenStreams(t *testing.T, accounts account.Store, events event.Store, newBackend BackendFactory) {
 	for range 32 {
 		func() {
-			testEnv, cleanup := setupTest(t, accounts, events, true)
+			testEnv, cleanup := setupTest(t, accounts, events, newBackend, true)
 			defer cleanup()
 
 			userID := model.MustGenerateUserID()
@@ -126,8 +175,8 @@ func testMultipleOpenStreams(t *testing.T, accounts account.Store, events event.
 	}
 }
 
-func testKeepAlive(t *testing.T, accounts account.Store, events event.Store) {
-	testEnv, cleanup := setupTest(t, accounts, events, false)
+func testKeepAlive(t *testing.T, accounts account.Store, events event.Store, newBackend BackendFactory) {
+	testEnv, cleanup := setupTest(t, accounts, events, newBackend, false)
 	defer cleanup()
 
 	userID := model.MustGenerateUserID()
@@ -144,8 +193,8 @@ func testKeepAlive(t *testing.T, accounts account.Store, events event.Store) {
 	require.True(t, pingCount <= 2)
 }
 
-func testRendezvousRecord(t *testing.T, accounts account.Store, events event.Store) {
-	testEnv, cleanup := setupTest(t, accounts, events, false)
+func testRendezvousRecord(t *testing.T, accounts account.Store, events event.Store, newBackend BackendFactory) {
+	testEnv, cleanup := setupTest(t, accounts, events, newBackend, false)
 	defer cleanup()
 
 	userID := model.MustGenerateUserID()
@@ -166,6 +215,451 @@ func testRendezvousRecord(t *testing.T, accounts account.Store, events event.Sto
 	testEnv.server1.assertNoRendezvousRecord(t, userID)
 }
 
+func testInboxReplay(t *testing.T, accounts account.Store, events event.Store, newBackend BackendFactory) {
+	testEnv, cleanup := setupTest(t, accounts, events, newBackend, true)
+	defer cleanup()
+
+	userID := model.MustGenerateUserID()
+	keyPair := model.MustGenerateKeyPair()
+	accounts.Bind(context.Background(), userID, keyPair.Proto())
+	accounts.SetRegistrationFlag(context.Background(), userID, true)
+
+	// Events sent without a stream are kept in the user's inbox
+	var expected []*eventpb.Event
+	for i := range 3 {
+		sender := testEnv.server1
+		if i%2 == 0 {
+			sender = testEnv.server2
+		}
+		expected = append(expected, sender.sendTestUserEvent(userID))
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	time.Sleep(500 * time.Millisecond)
+
+	testEnv.client1.openUserEventStream(t, userID, keyPair)
+
+	allActual := testEnv.client1.receiveEventsInRealTime(t, userID)
+	require.Len(t, allActual, len(expected))
+	for i := range expected {
+		assertEquivalentTestEvents(t, expected[i], allActual[i])
+	}
+
+	// Replayed events that aren't acknowledged are replayed to the app install's
+	// next stream
+	cursor, err := events.GetInboxCursor(context.Background(), model.UserIDString(userID), "")
+	require.NoError(t, err)
+	require.Zero(t, cursor)
+
+	testEnv.client1.closeUserEventStream(t, userID)
+
+	time.Sleep(500 * time.Millisecond)
+
+	testEnv.client1.openUserEventStream(t, userID, keyPair)
+
+	allActual = testEnv.client1.receiveEventsInRealTime(t, userID)
+	require.Len(t, allActual, len(expected))
+	for i := range expected {
+		assertEquivalentTestEvents(t, expected[i], allActual[i])
+	}
+
+	// Acknowledged events are skipped by the app install's next stream
+	testEnv.client1.acknowledgeEvents(t, userID)
+
+	inboxEvents, err := events.GetInboxEvents(context.Background(), model.UserIDString(userID), 0, 10)
+	require.NoError(t, err)
+	require.Len(t, inboxEvents, len(expected))
+
+	require.Eventually(t, func() bool {
+		cursor, err := events.GetInboxCursor(context.Background(), model.UserIDString(userID), "")
+		require.NoError(t, err)
+		return cursor == inboxEvents[len(inboxEvents)-1].Sequence
+	}, time.Second, 50*time.Millisecond)
+
+	// Live delivery resumes after the replay. Live events are also kept in the
+	// inbox, and the app install's cursor moves past them once delivered.
+	expectedLive := testEnv.server2.sendTestUserEvent(userID)
+	allActual = testEnv.client1.receiveEventsInRealTime(t, userID)
+	require.Len(t, allActual, 1)
+	assertEquivalentTestEvents(t, expectedLive, allActual[0])
+
+	inboxEvents, err = events.GetInboxEvents(context.Background(), model.UserIDString(userID), 0, 10)
+	require.NoError(t, err)
+	require.Len(t, inboxEvents, len(expected)+1)
+	assertEquivalentTestEvents(t, expectedLive, inboxEvents[len(inboxEvents)-1].Event)
+
+	require.Eventually(t, func() bool {
+		cursor, err := events.GetInboxCursor(context.Background(), model.UserIDString(userID), "")
+		require.NoError(t, err)
+		return cursor == inboxEvents[len(inboxEvents)-1].Sequence
+	}, time.Second, 50*time.Millisecond)
+}
+
+func testInboxReplayPerAppInstall(t *testing.T, accounts account.Store, events event.Store, newBackend BackendFactory) {
+	testEnv, cleanup := setupTest(t, accounts, events, newBackend, true)
+	defer cleanup()
+
+	userID := model.MustGenerateUserID()
+	keyPair := model.MustGenerateKeyPair()
+	accounts.Bind(context.Background(), userID, keyPair.Proto())
+	accounts.SetRegistrationFlag(context.Background(), userID, true)
+
+	var expected []*eventpb.Event
+	for i := range 3 {
+		sender := testEnv.server1
+		if i%2 == 0 {
+			sender = testEnv.server2
+		}
+		expected = append(expected, sender.sendTestUserEvent(userID))
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	time.Sleep(500 * time.Millisecond)
+
+	// Each app install replays the inbox, regardless of which replayed it first
+	for _, client := range []*clientTestEnv{testEnv.client1, testEnv.client2} {
+		appInstallID := "phone"
+		if client == testEnv.client2 {
+			appInstallID = "tablet"
+		}
+
+		client.openAppInstallEventStream(t, userID, keyPair, appInstallID)
+
+		allActual := client.receiveEventsInRealTime(t, userID)
+		require.Len(t, allActual, len(expected))
+		for i := range expected {
+			assertEquivalentTestEvents(t, expected[i], allActual[i])
+		}
+
+		client.acknowledgeEvents(t, userID)
+		require.Eventually(t, func() bool {
+			cursor, err := events.GetInboxCursor(context.Background(), model.UserIDString(userID), appInstallID)
+			require.NoError(t, err)
+			return cursor > 0
+		}, time.Second, 50*time.Millisecond)
+
+		client.closeUserEventStream(t, userID)
+	}
+
+	time.Sleep(500 * time.Millisecond)
+
+	// App installs don't replay events that were already replayed to them
+	testEnv.client1.openAppInstallEventStream(t, userID, keyPair, "phone")
+
+	time.Sleep(500 * time.Millisecond)
+
+	expectedLive := testEnv.server2.sendTestUserEvent(userID)
+	allActual := testEnv.client1.receiveEventsInRealTime(t, userID)
+	require.Len(t, allActual, 1)
+	assertEquivalentTestEvents(t, expectedLive, allActual[0])
+}
+
+func testInboxReplaySkipsReplayedLiveEvents(t *testing.T, accounts account.Store, events event.Store, newBackend BackendFactory) {
+	// Inbox events are delivered live as streams register, so they race the
+	// replay like events published while a stream opens
+	newRacingBackend := func(log *zap.Logger, events event.Store, broadcastAddress, internalRpcApiKey string) event.StreamBackendCtor {
+		ctor := newBackend(log, events, broadcastAddress, internalRpcApiKey)
+		return func(local event.LocalStreams) event.StreamBackend {
+			return &liveInboxEventsBackend{
+				StreamBackend: ctor(local),
+				local:         local,
+				events:        events,
+			}
+		}
+	}
+
+	testEnv, cleanup := setupTest(t, accounts, events, newRacingBackend, false)
+	defer cleanup()
+
+	userID := model.MustGenerateUserID()
+	keyPair := model.MustGenerateKeyPair()
+	accounts.Bind(context.Background(), userID, keyPair.Proto())
+	accounts.SetRegistrationFlag(context.Background(), userID, true)
+
+	var expected []*eventpb.Event
+	for range 3 {
+		expected = append(expected, testEnv.server1.sendTestUserEvent(userID))
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	time.Sleep(500 * time.Millisecond)
+
+	testEnv.client1.openUserEventStream(t, userID, keyPair)
+
+	allActual := testEnv.client1.receiveEventsInRealTime(t, userID)
+	require.Len(t, allActual, len(expected))
+	for i := range expected {
+		assertEquivalentTestEvents(t, expected[i], allActual[i])
+	}
+
+	// The live deliveries of replayed events aren't received again
+	expectedLive := testEnv.server1.sendTestUserEvent(userID)
+	allActual = testEnv.client1.receiveEventsInRealTime(t, userID)
+	require.Len(t, allActual, 1)
+	assertEquivalentTestEvents(t, expectedLive, allActual[0])
+}
+
+func testInboxReplayResumesFromClientEvent(t *testing.T, accounts account.Store, events event.Store, newBackend BackendFactory) {
+	testEnv, cleanup := setupTest(t, accounts, events, newBackend, false)
+	defer cleanup()
+
+	userID := model.MustGenerateUserID()
+	keyPair := model.MustGenerateKeyPair()
+	accounts.Bind(context.Background(), userID, keyPair.Proto())
+	accounts.SetRegistrationFlag(context.Background(), userID, true)
+
+	var expected []*eventpb.Event
+	for range 3 {
+		expected = append(expected, testEnv.server1.sendTestUserEvent(userID))
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	time.Sleep(500 * time.Millisecond)
+
+	// Resuming from an event that isn't in the inbox replays everything after
+	// the app install's cursor
+	testEnv.client1.openResumedEventStream(t, userID, keyPair, "phone", event.MustGenerateEventID())
+
+	allActual := testEnv.client1.receiveEventsInRealTime(t, userID)
+	require.Len(t, allActual, len(expected))
+	for i := range expected {
+		assertEquivalentTestEvents(t, expected[i], allActual[i])
+	}
+
+	testEnv.client1.closeUserEventStream(t, userID)
+
+	time.Sleep(500 * time.Millisecond)
+
+	// Events up to the client's last received event aren't replayed again
+	testEnv.client1.openResumedEventStream(t, userID, keyPair, "phone", expected[0].Id)
+
+	allActual = testEnv.client1.receiveEventsInRealTime(t, userID)
+	require.Len(t, allActual, len(expected)-1)
+	for i := range allActual {
+		assertEquivalentTestEvents(t, expected[i+1], allActual[i])
+	}
+
+	testEnv.client1.closeUserEventStream(t, userID)
+
+	time.Sleep(500 * time.Millisecond)
+
+	// Resuming from the latest event skips the whole replay, and the cursor moves
+	// past it once the client acknowledges
+	testEnv.client1.openResumedEventStream(t, userID, keyPair, "phone", expected[len(expected)-1].Id)
+	testEnv.client1.acknowledgeEvents(t, userID)
+
+	inboxEvents, err := events.GetInboxEvents(context.Background(), model.UserIDString(userID), 0, 10)
+	require.NoError(t, err)
+	require.Len(t, inboxEvents, len(expected))
+
+	require.Eventually(t, func() bool {
+		cursor, err := events.GetInboxCursor(context.Background(), model.UserIDString(userID), "phone")
+		require.NoError(t, err)
+		return cursor == inboxEvents[len(inboxEvents)-1].Sequence
+	}, time.Second, 50*time.Millisecond)
+
+	expectedLive := testEnv.server1.sendTestUserEvent(userID)
+	allActual = testEnv.client1.receiveEventsInRealTime(t, userID)
+	require.Len(t, allActual, 1)
+	assertEquivalentTestEvents(t, expectedLive, allActual[0])
+}
+
+func testInboxReplayNewAppInstall(t *testing.T, accounts account.Store, events event.Store, newBackend BackendFactory) {
+	// Every event already in the inbox was added before the replay window
+	agedEvents := &testAgedInboxStore{Store: events}
+
+	testEnv, cleanup := setupTest(t, accounts, agedEvents, newBackend, false)
+	defer cleanup()
+
+	userID := model.MustGenerateUserID()
+	keyPair := model.MustGenerateKeyPair()
+	accounts.Bind(context.Background(), userID, keyPair.Proto())
+	accounts.SetRegistrationFlag(context.Background(), userID, true)
+
+	for range 3 {
+		testEnv.server1.sendTestUserEvent(userID)
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	time.Sleep(500 * time.Millisecond)
+
+	// New app installs start at the head of the inbox
+	testEnv.client1.openAppInstallEventStream(t, userID, keyPair, "phone")
+
+	time.Sleep(500 * time.Millisecond)
+
+	expectedLive := testEnv.server1.sendTestUserEvent(userID)
+	allActual := testEnv.client1.receiveEventsInRealTime(t, userID)
+	require.Len(t, allActual, 1)
+	assertEquivalentTestEvents(t, expectedLive, allActual[0])
+
+	inboxEvents, err := events.GetInboxEvents(context.Background(), model.UserIDString(userID), 0, 10)
+	require.NoError(t, err)
+	require.Len(t, inboxEvents, 4)
+
+	require.Eventually(t, func() bool {
+		cursor, err := events.GetInboxCursor(context.Background(), model.UserIDString(userID), "phone")
+		require.NoError(t, err)
+		return cursor == inboxEvents[len(inboxEvents)-1].Sequence
+	}, time.Second, 50*time.Millisecond)
+
+	testEnv.client1.closeUserEventStream(t, userID)
+
+	time.Sleep(500 * time.Millisecond)
+
+	// The app install is no longer new, so it replays everything after its cursor
+	expected := testEnv.server1.sendTestUserEvent(userID)
+
+	time.Sleep(500 * time.Millisecond)
+
+	testEnv.client1.openAppInstallEventStream(t, userID, keyPair, "phone")
+
+	allActual = testEnv.client1.receiveEventsInRealTime(t, userID)
+	require.Len(t, allActual, 1)
+	assertEquivalentTestEvents(t, expected, allActual[0])
+}
+
+func testForwardEventsWithoutInboxSequences(t *testing.T, accounts account.Store, events event.Store, newBackend BackendFactory) {
+	testEnv, cleanup := setupTest(t, accounts, events, newBackend, false)
+	defer cleanup()
+
+	userID := model.MustGenerateUserID()
+	keyPair := model.MustGenerateKeyPair()
+	accounts.Bind(context.Background(), userID, keyPair.Proto())
+	accounts.SetRegistrationFlag(context.Background(), userID, true)
+
+	testEnv.client1.openUserEventStream(t, userID, keyPair)
+	testEnv.client1.acknowledgeEvents(t, userID)
+
+	// Events from senders that don't send inbox sequences are delivered live
+	expected := &eventpb.Event{
+		Id:   event.MustGenerateEventID(),
+		Ts:   timestamppb.Now(),
+		Type: &eventpb.Event_Test{Test: &eventpb.TestEvent{Nonce: uint64(rand.Int64())}},
+	}
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-flipcash-internal-rpc-api-key", "valid-api-key")
+	resp, err := testEnv.client1.client.ForwardEvents(ctx, &eventpb.ForwardEventsRequest{
+		UserEvents: &eventpb.UserEventBatch{
+			Events: []*eventpb.UserEvent{{UserId: userID, Event: expected}},
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, eventpb.ForwardEventsResponse_OK, resp.Result)
+
+	allActual := testEnv.client1.receiveEventsInRealTime(t, userID)
+	require.Len(t, allActual, 1)
+	require.NoError(t, protoutil.ProtoEqualError(expected.Id, allActual[0].Id))
+
+	// The app install's inbox cursor doesn't move
+	time.Sleep(500 * time.Millisecond)
+
+	cursor, err := events.GetInboxCursor(context.Background(), model.UserIDString(userID), "")
+	require.NoError(t, err)
+	require.Zero(t, cursor)
+}
+
+func testBatchedForwarding(t *testing.T, accounts account.Store, events event.Store, newBackend BackendFactory) {
+	testEnv, cleanup := setupTest(t, accounts, events, newBackend, true)
+	defer cleanup()
+
+	var userIDs []*commonpb.UserId
+	for range 3 {
+		userID := model.MustGenerateUserID()
+		keyPair := model.MustGenerateKeyPair()
+		accounts.Bind(context.Background(), userID, keyPair.Proto())
+		accounts.SetRegistrationFlag(context.Background(), userID, true)
+
+		testEnv.client1.openUserEventStream(t, userID, keyPair)
+
+		userIDs = append(userIDs, userID)
+	}
+
+	time.Sleep(500 * time.Millisecond)
+
+	// Events sent in quick succession are forwarded together, in order for each user
+	expectedByUser := make(map[string][]*eventpb.Event)
+	for range 50 {
+		for _, userID := range userIDs {
+			key := model.UserIDString(userID)
+			expectedByUser[key] = append(expectedByUser[key], testEnv.server2.sendTestUserEvent(userID))
+		}
+	}
+
+	for _, userID := range userIDs {
+		expected := expectedByUser[model.UserIDString(userID)]
+
+		var numBatches int
+		var allActual []*eventpb.Event
+		for len(allActual) < len(expected) {
+			batch := testEnv.client1.receiveEventsInRealTime(t, userID)
+			require.NotEmpty(t, batch)
+			allActual = append(allActual, batch...)
+			numBatches++
+		}
+
+		require.Len(t, allActual, len(expected))
+		for i := range expected {
+			assertEquivalentTestEvents(t, expected[i], allActual[i])
+			require.Equal(t, []string{testEnv.server2.address, testEnv.server1.address}, allActual[i].GetTest().Hops)
+		}
+		require.Less(t, numBatches, len(expected))
+	}
+}
+
+func testMultipleAppInstalls(t *testing.T, accounts account.Store, events event.Store, newBackend BackendFactory) {
+	testEnv, cleanup := setupTest(t, accounts, events, newBackend, true)
+	defer cleanup()
+
+	userID := model.MustGenerateUserID()
+	keyPair := model.MustGenerateKeyPair()
+	accounts.Bind(context.Background(), userID, keyPair.Proto())
+	accounts.SetRegistrationFlag(context.Background(), userID, true)
+
+	// Each app install keeps its own stream, across servers
+	testEnv.client1.openAppInstallEventStream(t, userID, keyPair, "phone")
+	testEnv.client2.openAppInstallEventStream(t, userID, keyPair, "tablet")
+
+	time.Sleep(500 * time.Millisecond)
+
+	for _, appInstallID := range []string{"phone", "tablet"} {
+		_, err := events.GetRendezvous(context.Background(), model.UserIDString(userID), appInstallID)
+		require.NoError(t, err)
+	}
+
+	for i := range 20 {
+		sender := testEnv.server1
+		if i%2 == 0 {
+			sender = testEnv.server2
+		}
+
+		expected := sender.sendTestUserEvent(userID)
+
+		fromPhone := testEnv.client1.receiveEventsInRealTime(t, userID)
+		require.Len(t, fromPhone, 1)
+		assertEquivalentTestEvents(t, expected, fromPhone[0])
+
+		fromTablet := testEnv.client2.receiveEventsInRealTime(t, userID)
+		require.Len(t, fromTablet, 1)
+		assertEquivalentTestEvents(t, expected, fromTablet[0])
+	}
+
+	// Reopening on the same app install only replaces that app install's stream
+	testEnv.client2.closeUserEventStream(t, userID)
+	testEnv.client2.openAppInstallEventStream(t, userID, keyPair, "tablet")
+
+	time.Sleep(500 * time.Millisecond)
+
+	expected := testEnv.server1.sendTestUserEvent(userID)
+
+	fromPhone := testEnv.client1.receiveEventsInRealTime(t, userID)
+	require.Len(t, fromPhone, 1)
+	assertEquivalentTestEvents(t, expected, fromPhone[0])
+
+	fromTablet := testEnv.client2.receiveEventsInRealTime(t, userID)
+	require.Len(t, fromTablet, 1)
+	assertEquivalentTestEvents(t, expected, fromTablet[0])
+}
+
 type testEnv struct {
 	client1 *clientTestEnv
 	client2 *clientTestEnv
@@ -190,7 +684,43 @@ type cancellableStream struct {
 	cancel func()
 }
 
-func setupTest(t *testing.T, accounts account.Store, events event.Store, enableMultiServer bool) (env testEnv, cleanup func()) {
+// liveInboxEventsBackend delivers the events in a user's inbox to their local
+// streams as each stream registers
+type liveInboxEventsBackend struct {
+	event.StreamBackend
+
+	local  event.LocalStreams
+	events event.Store
+}
+
+func (b *liveInboxEventsBackend) RegisterStream(ctx context.Context, key, appInstallID string) error {
+	if err := b.StreamBackend.RegisterStream(ctx, key, appInstallID); err != nil {
+		return err
+	}
+
+	inboxEvents, err := b.events.GetInboxEvents(ctx, key, 0, 100)
+	if err != nil {
+		return err
+	}
+	for _, inboxEvent := range inboxEvents {
+		if _, err := b.local.DeliverInboxEvent(ctx, inboxEvent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// testAgedInboxStore treats every event in the inbox as added before the new
+// app install replay window
+type testAgedInboxStore struct {
+	event.Store
+}
+
+func (s *testAgedInboxStore) GetInboxSequenceAddedBefore(ctx context.Context, key string, _ time.Time) (uint64, error) {
+	return s.Store.GetInboxSequenceAddedBefore(ctx, key, time.Now())
+}
+
+func setupTest(t *testing.T, accounts account.Store, events event.Store, newBackend BackendFactory, enableMultiServer bool) (env testEnv, cleanup func()) {
 	log := zaptest.NewLogger(t)
 
 	conn1, serv1, err := codetestutil.NewServer()
@@ -231,6 +761,7 @@ func setupTest(t *testing.T, accounts account.Store, events event.Store, enableM
 			nil,
 			conn1.Target(),
 			internalRpcApiKey,
+			newBackend(log, events, conn1.Target(), internalRpcApiKey),
 		),
 	}
 	env.server2 = &serverTestEnv{
@@ -246,6 +777,7 @@ func setupTest(t *testing.T, accounts account.Store, events event.Store, enableM
 			nil,
 			conn2.Target(),
 			internalRpcApiKey,
+			newBackend(log, events, conn2.Target(), internalRpcApiKey),
 		),
 	}
 
@@ -283,21 +815,37 @@ func (s *serverTestEnv) sendTestUserEvent(userID *commonpb.UserId) *eventpb.Even
 }
 
 func (s *serverTestEnv) assertRendezvousRecordExists(t *testing.T, userID *commonpb.UserId) {
-	rendezvous, err := s.events.GetRendezvous(context.Background(), model.UserIDString(userID))
+	rendezvous, err := s.events.GetRendezvous(context.Background(), model.UserIDString(userID), "")
 	require.NoError(t, err)
 	require.Equal(t, s.address, rendezvous.Address)
 	require.True(t, rendezvous.ExpiresAt.After(time.Now()))
 }
 
 func (s *serverTestEnv) assertNoRendezvousRecord(t *testing.T, userID *commonpb.UserId) {
-	_, err := s.events.GetRendezvous(t.Context(), model.UserIDString(userID))
+	_, err := s.events.GetRendezvous(t.Context(), model.UserIDString(userID), "")
 	require.Equal(t, event.ErrRendezvousNotFound, err)
 }
 
 func (c *clientTestEnv) openUserEventStream(t *testing.T, userID *commonpb.UserId, keyPair model.KeyPair) {
+	c.openAppInstallEventStream(t, userID, keyPair, "")
+}
+
+func (c *clientTestEnv) openAppInstallEventStream(t *testing.T, userID *commonpb.UserId, keyPair model.KeyPair, appInstallID string) {
+	c.openResumedEventStream(t, userID, keyPair, appInstallID, nil)
+}
+
+// openResumedEventStream opens a stream that resumes from the last event the
+// client received
+func (c *clientTestEnv) openResumedEventStream(t *testing.T, userID *commonpb.UserId, keyPair model.KeyPair, appInstallID string, resumeEventID *eventpb.EventId) {
 	key := model.UserIDString(userID)
 
 	cancellableCtx, cancel := context.WithCancel(context.Background())
+	if len(appInstallID) > 0 {
+		cancellableCtx = metadata.AppendToOutgoingContext(cancellableCtx, "x-flipcash-app-install-id", appInstallID)
+	}
+	if resumeEventID != nil {
+		cancellableCtx = metadata.AppendToOutgoingContext(cancellableCtx, "x-flipcash-resume-event-id", event.EventIDString(resumeEventID))
+	}
 
 	req := &eventpb.StreamEventsRequest{
 		Type: &eventpb.StreamEventsRequest_Params_{
@@ -363,6 +911,39 @@ func (c *clientTestEnv) receiveEventsInRealTime(t *testing.T, userID *commonpb.U
 	return nil
 }
 
+// acknowledgeEvents pongs the next ping on the user's stream, acknowledging the
+// events received before it
+func (c *clientTestEnv) acknowledgeEvents(t *testing.T, userID *commonpb.UserId) {
+	key := model.UserIDString(userID)
+
+	streamers, ok := c.streams[key]
+	require.True(t, ok)
+	require.Len(t, streamers, 1)
+	streamer := streamers[0]
+
+	for {
+		resp, err := streamer.stream.Recv()
+		require.NoError(t, err)
+
+		switch typed := resp.Type.(type) {
+		case *eventpb.StreamEventsResponse_Ping:
+			require.NoError(t, streamer.stream.Send(&eventpb.StreamEventsRequest{
+				Type: &eventpb.StreamEventsRequest_Pong{
+					Pong: &eventpb.ClientPong{
+						Timestamp: timestamppb.Now(),
+					},
+				},
+			}))
+			return
+		case *eventpb.StreamEventsResponse_Error:
+			require.Failf(t, "stream result code %s", typed.Error.Code.String())
+		case *eventpb.StreamEventsResponse_Events:
+		default:
+			require.Fail(t, "events, ping or error wasn't set")
+		}
+	}
+}
+
 func (c *clientTestEnv) waitUntilStreamTerminationOrTimeout(t *testing.T, userID *commonpb.UserId, keepStreamAlive bool, timeout time.Duration) int {
 	key := model.UserIDString(userID)
 
@@ -6,14 +6,24 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	eventpb "github.com/code-payments/flipcash-protobuf-api/generated/go/event/v1"
 
 	"github.com/code-payments/flipcash-server/event"
+	"github.com/code-payments/flipcash-server/protoutil"
 )
 
 func RunStoreTests(t *testing.T, s event.Store, teardown func()) {
 	for _, tf := range []func(t *testing.T, s event.Store){
 		testEventStore_RendezvousHappyPath,
 		testEventStore_RendezvousExpiredRecord,
+		testEventStore_RendezvousBatch,
+		testEventStore_RendezvousPerAppInstall,
+		testEventStore_InboxHappyPath,
+		testEventStore_InboxBatch,
+		testEventStore_InboxCursorHappyPath,
+		testEventStore_InboxSweep,
 	} {
 		tf(t, s)
 		teardown()
@@ -24,20 +34,21 @@ func testEventStore_RendezvousHappyPath(t *testing.T, s event.Store) {
 	ctx := context.Background()
 
 	record := &event.Rendezvous{
-		Key:       "key",
-		Address:   "localhost:1234",
-		ExpiresAt: time.Now().Add(time.Second),
+		Key:          "key",
+		AppInstallID: "app1",
+		Address:      "localhost:1234",
+		ExpiresAt:    time.Now().Add(time.Second),
 	}
 	cloned := record.Clone()
 
-	require.NoError(t, s.DeleteRendezvous(ctx, record.Key, record.Address))
-	_, err := s.GetRendezvous(ctx, record.Key)
+	require.NoError(t, s.DeleteRendezvous(ctx, record.Key, record.AppInstallID, record.Address))
+	_, err := s.GetRendezvous(ctx, record.Key, record.AppInstallID)
 	require.Equal(t, event.ErrRendezvousNotFound, err)
-	require.Equal(t, event.ErrRendezvousNotFound, s.ExtendRendezvousExpiry(ctx, record.Key, record.Address, time.Now().Add(time.Minute)))
+	require.Equal(t, event.ErrRendezvousNotFound, s.ExtendRendezvousExpiry(ctx, record.Key, record.AppInstallID, record.Address, time.Now().Add(time.Minute)))
 
 	require.NoError(t, s.CreateRendezvous(ctx, record))
 
-	actual, err := s.GetRendezvous(ctx, record.Key)
+	actual, err := s.GetRendezvous(ctx, record.Key, record.AppInstallID)
 	require.NoError(t, err)
 	assertEquivalentRendezvous(t, cloned, actual)
 
@@ -50,27 +61,27 @@ func testEventStore_RendezvousHappyPath(t *testing.T, s event.Store) {
 	time.Sleep(time.Second)
 	require.NoError(t, s.CreateRendezvous(ctx, record))
 
-	actual, err = s.GetRendezvous(ctx, record.Key)
+	actual, err = s.GetRendezvous(ctx, record.Key, record.AppInstallID)
 	require.NoError(t, err)
 	assertEquivalentRendezvous(t, cloned, actual)
 
 	record.ExpiresAt = record.ExpiresAt.Add(10 * time.Minute)
 	cloned = record.Clone()
-	require.NoError(t, s.ExtendRendezvousExpiry(ctx, record.Key, record.Address, record.ExpiresAt))
+	require.NoError(t, s.ExtendRendezvousExpiry(ctx, record.Key, record.AppInstallID, record.Address, record.ExpiresAt))
 
-	actual, err = s.GetRendezvous(ctx, record.Key)
+	actual, err = s.GetRendezvous(ctx, record.Key, record.AppInstallID)
 	require.NoError(t, err)
 	assertEquivalentRendezvous(t, cloned, actual)
 
-	require.NoError(t, s.DeleteRendezvous(ctx, record.Key, "localhost:8888"))
+	require.NoError(t, s.DeleteRendezvous(ctx, record.Key, record.AppInstallID, "localhost:8888"))
 
-	actual, err = s.GetRendezvous(ctx, record.Key)
+	actual, err = s.GetRendezvous(ctx, record.Key, record.AppInstallID)
 	require.NoError(t, err)
 	assertEquivalentRendezvous(t, cloned, actual)
 
-	require.NoError(t, s.DeleteRendezvous(ctx, record.Key, record.Address))
+	require.NoError(t, s.DeleteRendezvous(ctx, record.Key, record.AppInstallID, record.Address))
 
-	_, err = s.GetRendezvous(ctx, record.Key)
+	_, err = s.GetRendezvous(ctx, record.Key, record.AppInstallID)
 	require.Equal(t, event.ErrRendezvousNotFound, err)
 }
 
@@ -86,15 +97,324 @@ func testEventStore_RendezvousExpiredRecord(t *testing.T, s event.Store) {
 
 	time.Sleep(200 * time.Millisecond)
 
-	_, err := s.GetRendezvous(ctx, record.Key)
+	_, err := s.GetRendezvous(ctx, record.Key, record.AppInstallID)
+	require.Equal(t, event.ErrRendezvousNotFound, err)
+	require.Equal(t, event.ErrRendezvousNotFound, s.ExtendRendezvousExpiry(ctx, record.Key, record.AppInstallID, record.Address, time.Now().Add(time.Minute)))
+
+	require.NoError(t, s.DeleteRendezvous(ctx, record.Key, record.AppInstallID, record.Address))
+}
+
+func testEventStore_RendezvousBatch(t *testing.T, s event.Store) {
+	ctx := context.Background()
+
+	actual, err := s.GetRendezvousBatch(ctx, "key1", "key2")
+	require.NoError(t, err)
+	require.Empty(t, actual)
+
+	expected := map[string]*event.Rendezvous{
+		"key1": {Key: "key1", Address: "localhost:1234", ExpiresAt: time.Now().Add(time.Minute)},
+		"key2": {Key: "key2", Address: "localhost:5678", ExpiresAt: time.Now().Add(time.Minute)},
+	}
+	for _, record := range expected {
+		require.NoError(t, s.CreateRendezvous(ctx, record))
+	}
+	require.NoError(t, s.CreateRendezvous(ctx, &event.Rendezvous{
+		Key:       "key3",
+		Address:   "localhost:1234",
+		ExpiresAt: time.Now().Add(100 * time.Millisecond),
+	}))
+
+	time.Sleep(200 * time.Millisecond)
+
+	actual, err = s.GetRendezvousBatch(ctx, "key1", "key2", "key3", "key4")
+	require.NoError(t, err)
+	require.Len(t, actual, len(expected))
+	for _, record := range actual {
+		assertEquivalentRendezvous(t, expected[record.Key], record)
+	}
+}
+
+func testEventStore_RendezvousPerAppInstall(t *testing.T, s event.Store) {
+	ctx := context.Background()
+
+	records := []*event.Rendezvous{
+		{Key: "key", AppInstallID: "app1", Address: "localhost:1234", ExpiresAt: time.Now().Add(time.Minute)},
+		{Key: "key", AppInstallID: "app2", Address: "localhost:5678", ExpiresAt: time.Now().Add(time.Minute)},
+		{Key: "key", AppInstallID: "", Address: "localhost:1234", ExpiresAt: time.Now().Add(time.Minute)},
+	}
+	for _, record := range records {
+		require.NoError(t, s.CreateRendezvous(ctx, record))
+		require.Equal(t, event.ErrRendezvousExists, s.CreateRendezvous(ctx, record))
+	}
+
+	for _, record := range records {
+		actual, err := s.GetRendezvous(ctx, record.Key, record.AppInstallID)
+		require.NoError(t, err)
+		assertEquivalentRendezvous(t, record, actual)
+	}
+
+	_, err := s.GetRendezvous(ctx, "key", "app3")
+	require.Equal(t, event.ErrRendezvousNotFound, err)
+
+	actual, err := s.GetRendezvousBatch(ctx, "key")
+	require.NoError(t, err)
+	require.Len(t, actual, len(records))
+
+	require.Equal(t, event.ErrRendezvousNotFound, s.ExtendRendezvousExpiry(ctx, "key", "app1", "localhost:5678", time.Now().Add(time.Hour)))
+	require.NoError(t, s.ExtendRendezvousExpiry(ctx, "key", "app2", "localhost:5678", time.Now().Add(time.Hour)))
+
+	require.NoError(t, s.DeleteRendezvous(ctx, "key", "app1", "localhost:1234"))
+
+	_, err = s.GetRendezvous(ctx, "key", "app1")
 	require.Equal(t, event.ErrRendezvousNotFound, err)
-	require.Equal(t, event.ErrRendezvousNotFound, s.ExtendRendezvousExpiry(ctx, record.Key, record.Address, time.Now().Add(time.Minute)))
 
-	require.NoError(t, s.DeleteRendezvous(ctx, record.Key, record.Address))
+	actual, err = s.GetRendezvousBatch(ctx, "key")
+	require.NoError(t, err)
+	require.Len(t, actual, 2)
+}
+
+func testEventStore_InboxHappyPath(t *testing.T, s event.Store) {
+	ctx := context.Background()
+
+	_, err := s.GetInboxEvents(ctx, "key1", 0, 10)
+	require.Equal(t, event.ErrInboxEventNotFound, err)
+
+	var expected []*event.InboxEvent
+	for i := range 5 {
+		inboxEvent := &event.InboxEvent{
+			Key: "key1",
+			Event: &eventpb.Event{
+				Id:   event.MustGenerateEventID(),
+				Ts:   timestamppb.Now(),
+				Type: &eventpb.Event_Test{Test: &eventpb.TestEvent{Nonce: uint64(i)}},
+			},
+			ExpiresAt: time.Now().Add(time.Minute),
+		}
+		require.NoError(t, s.AddInboxEvents(ctx, inboxEvent))
+		require.NotZero(t, inboxEvent.Sequence)
+		if len(expected) > 0 {
+			require.True(t, inboxEvent.Sequence > expected[len(expected)-1].Sequence)
+		}
+		expected = append(expected, inboxEvent.Clone())
+
+		require.NoError(t, s.AddInboxEvents(ctx, &event.InboxEvent{
+			Key:       "key2",
+			Event:     inboxEvent.Event,
+			ExpiresAt: time.Now().Add(time.Minute),
+		}))
+	}
+
+	require.NoError(t, s.AddInboxEvents(ctx, &event.InboxEvent{
+		Key: "key1",
+		Event: &eventpb.Event{
+			Id:   event.MustGenerateEventID(),
+			Ts:   timestamppb.Now(),
+			Type: &eventpb.Event_Test{Test: &eventpb.TestEvent{}},
+		},
+		ExpiresAt: time.Now().Add(-time.Minute),
+	}))
+
+	actual, err := s.GetInboxEvents(ctx, "key1", 0, 10)
+	require.NoError(t, err)
+	assertEquivalentInboxEvents(t, expected, actual)
+
+	actual, err = s.GetInboxEvents(ctx, "key1", 0, 2)
+	require.NoError(t, err)
+	assertEquivalentInboxEvents(t, expected[:2], actual)
+
+	actual, err = s.GetInboxEvents(ctx, "key1", expected[1].Sequence, 10)
+	require.NoError(t, err)
+	assertEquivalentInboxEvents(t, expected[2:], actual)
+
+	_, err = s.GetInboxEvents(ctx, "key1", expected[4].Sequence, 10)
+	require.Equal(t, event.ErrInboxEventNotFound, err)
+
+	// Unexpired events are kept for every app install
+	require.NoError(t, s.DeleteExpiredInboxEvents(ctx, "key1"))
+
+	actual, err = s.GetInboxEvents(ctx, "key1", 0, 10)
+	require.NoError(t, err)
+	assertEquivalentInboxEvents(t, expected, actual)
+
+	actual, err = s.GetInboxEvents(ctx, "key2", 0, 10)
+	require.NoError(t, err)
+	require.Len(t, actual, 5)
+}
+
+func testEventStore_InboxBatch(t *testing.T, s event.Store) {
+	ctx := context.Background()
+
+	start := time.Now()
+
+	sequence, err := s.GetInboxSequenceAddedBefore(ctx, "key1", time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	require.Zero(t, sequence)
+
+	var batch []*event.InboxEvent
+	for i := range 5 {
+		key := "key1"
+		if i%2 == 1 {
+			key = "key2"
+		}
+
+		batch = append(batch, &event.InboxEvent{
+			Key: key,
+			Event: &eventpb.Event{
+				Id:   event.MustGenerateEventID(),
+				Ts:   timestamppb.Now(),
+				Type: &eventpb.Event_Test{Test: &eventpb.TestEvent{Nonce: uint64(i)}},
+			},
+			ExpiresAt: time.Now().Add(time.Minute),
+		})
+	}
+	require.NoError(t, s.AddInboxEvents(ctx, batch...))
+
+	// Sequences increase in the order events are provided
+	for i, inboxEvent := range batch {
+		require.NotZero(t, inboxEvent.Sequence)
+		if i > 0 {
+			require.True(t, inboxEvent.Sequence > batch[i-1].Sequence)
+		}
+	}
+
+	actual, err := s.GetInboxEvents(ctx, "key1", 0, 10)
+	require.NoError(t, err)
+	assertEquivalentInboxEvents(t, []*event.InboxEvent{batch[0], batch[2], batch[4]}, actual)
+
+	actual, err = s.GetInboxEvents(ctx, "key2", 0, 10)
+	require.NoError(t, err)
+	assertEquivalentInboxEvents(t, []*event.InboxEvent{batch[1], batch[3]}, actual)
+
+	require.NoError(t, s.AddInboxEvents(ctx))
+
+	sequence, err = s.GetInboxSequenceAddedBefore(ctx, "key1", time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, batch[4].Sequence, sequence)
+
+	sequence, err = s.GetInboxSequenceAddedBefore(ctx, "key2", time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, batch[3].Sequence, sequence)
+
+	sequence, err = s.GetInboxSequenceAddedBefore(ctx, "key1", start.Add(-time.Minute))
+	require.NoError(t, err)
+	require.Zero(t, sequence)
+}
+
+func testEventStore_InboxCursorHappyPath(t *testing.T, s event.Store) {
+	ctx := context.Background()
+
+	for _, appInstallID := range []string{"", "phone", "tablet"} {
+		_, err := s.GetInboxCursor(ctx, "key1", appInstallID)
+		require.Equal(t, event.ErrInboxCursorNotFound, err)
+	}
+
+	require.NoError(t, s.AdvanceInboxCursor(ctx, "key1", "phone", 10))
+	require.NoError(t, s.AdvanceInboxCursor(ctx, "key2", "tablet", 20))
+
+	// Cursors can start at zero
+	require.NoError(t, s.AdvanceInboxCursor(ctx, "key1", "", 0))
+
+	cursor, err := s.GetInboxCursor(ctx, "key1", "")
+	require.NoError(t, err)
+	require.Zero(t, cursor)
+
+	cursor, err = s.GetInboxCursor(ctx, "key1", "phone")
+	require.NoError(t, err)
+	require.EqualValues(t, 10, cursor)
+
+	_, err = s.GetInboxCursor(ctx, "key1", "tablet")
+	require.Equal(t, event.ErrInboxCursorNotFound, err)
+
+	cursor, err = s.GetInboxCursor(ctx, "key2", "tablet")
+	require.NoError(t, err)
+	require.EqualValues(t, 20, cursor)
+
+	// Cursors never move backwards
+	require.NoError(t, s.AdvanceInboxCursor(ctx, "key1", "phone", 5))
+
+	cursor, err = s.GetInboxCursor(ctx, "key1", "phone")
+	require.NoError(t, err)
+	require.EqualValues(t, 10, cursor)
+
+	require.NoError(t, s.AdvanceInboxCursor(ctx, "key1", "phone", 15))
+
+	cursor, err = s.GetInboxCursor(ctx, "key1", "phone")
+	require.NoError(t, err)
+	require.EqualValues(t, 15, cursor)
+}
+
+func testEventStore_InboxSweep(t *testing.T, s event.Store) {
+	ctx := context.Background()
+
+	expected := make(map[string]*event.InboxEvent)
+	for _, key := range []string{"key1", "key2"} {
+		for _, expiresAt := range []time.Time{time.Now().Add(-time.Minute), time.Now().Add(time.Minute)} {
+			inboxEvent := &event.InboxEvent{
+				Key: key,
+				Event: &eventpb.Event{
+					Id:   event.MustGenerateEventID(),
+					Ts:   timestamppb.Now(),
+					Type: &eventpb.Event_Test{Test: &eventpb.TestEvent{}},
+				},
+				ExpiresAt: expiresAt,
+			}
+			require.NoError(t, s.AddInboxEvents(ctx, inboxEvent))
+			expected[key] = inboxEvent.Clone()
+		}
+	}
+
+	// Unexpired events are kept in every inbox
+	require.NoError(t, s.DeleteAllExpiredInboxEvents(ctx))
+
+	for key, inboxEvent := range expected {
+		actual, err := s.GetInboxEvents(ctx, key, 0, 10)
+		require.NoError(t, err)
+		assertEquivalentInboxEvents(t, []*event.InboxEvent{inboxEvent}, actual)
+	}
+
+	require.NoError(t, s.AdvanceInboxCursor(ctx, "key1", "phone", expected["key1"].Sequence))
+	require.NoError(t, s.AdvanceInboxCursor(ctx, "key2", "tablet", expected["key2"].Sequence))
+	require.NoError(t, s.AdvanceInboxCursor(ctx, "key2", "laptop", expected["key2"].Sequence-1))
+
+	// Cursors that moved since are kept
+	require.NoError(t, s.DeleteStaleInboxCursors(ctx, time.Now().Add(-time.Minute)))
+
+	cursor, err := s.GetInboxCursor(ctx, "key1", "phone")
+	require.NoError(t, err)
+	require.Equal(t, expected["key1"].Sequence, cursor)
+
+	cursor, err = s.GetInboxCursor(ctx, "key2", "tablet")
+	require.NoError(t, err)
+	require.Equal(t, expected["key2"].Sequence, cursor)
+
+	// Cursors that haven't moved since are deleted, across every user, unless
+	// they still have unexpired events to replay
+	require.NoError(t, s.DeleteStaleInboxCursors(ctx, time.Now().Add(time.Minute)))
+
+	_, err = s.GetInboxCursor(ctx, "key1", "phone")
+	require.Equal(t, event.ErrInboxCursorNotFound, err)
+
+	_, err = s.GetInboxCursor(ctx, "key2", "tablet")
+	require.Equal(t, event.ErrInboxCursorNotFound, err)
+
+	cursor, err = s.GetInboxCursor(ctx, "key2", "laptop")
+	require.NoError(t, err)
+	require.Equal(t, expected["key2"].Sequence-1, cursor)
 }
 
 func assertEquivalentRendezvous(t *testing.T, obj1, obj2 *event.Rendezvous) {
 	require.Equal(t, obj1.Key, obj2.Key)
+	require.Equal(t, obj1.AppInstallID, obj2.AppInstallID)
 	require.Equal(t, obj1.Address, obj2.Address)
 	require.Equal(t, obj1.ExpiresAt.Unix(), obj2.ExpiresAt.Unix())
 }
+
+func assertEquivalentInboxEvents(t *testing.T, expected, actual []*event.InboxEvent) {
+	require.Len(t, actual, len(expected))
+	for i := range expected {
+		require.Equal(t, expected[i].Key, actual[i].Key)
+		require.Equal(t, expected[i].Sequence, actual[i].Sequence)
+		require.NoError(t, protoutil.ProtoEqualError(expected[i].Event, actual[i].Event))
+		require.Equal(t, expected[i].ExpiresAt.Unix(), actual[i].ExpiresAt.Unix())
+	}
+}
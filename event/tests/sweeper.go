@@ -0,0 +1,81 @@
+package tests
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"github.com/code-payments/flipcash-server/event"
+)
+
+const (
+	testSweeperInterval = 10 * time.Millisecond
+)
+
+func RunSweeperTests(t *testing.T, events event.Store, teardown func()) {
+	for _, tf := range []func(t *testing.T, events event.Store){
+		testSweeper_DeletesExpiredInboxesAndStaleCursors,
+	} {
+		tf(t, events)
+		teardown()
+	}
+}
+
+func testSweeper_DeletesExpiredInboxesAndStaleCursors(t *testing.T, events event.Store) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	recording := &testRecordingSweepStore{Store: events}
+
+	sweeper := event.NewInboxSweeper(zaptest.NewLogger(t), recording)
+	go sweeper.Start(ctx, testSweeperInterval)
+
+	require.Eventually(t, func() bool {
+		return recording.getNumSweeps() > 1
+	}, time.Second, testSweeperInterval)
+
+	// Cursors are only deleted once every event they're past has expired
+	movedBefore := recording.getLastMovedBefore()
+	require.WithinDuration(t, time.Now().Add(-event.InboxEventExpiryTime), movedBefore, time.Second)
+}
+
+// testRecordingSweepStore records the sweeps made against the store
+type testRecordingSweepStore struct {
+	event.Store
+
+	mu              sync.Mutex
+	numSweeps       int
+	lastMovedBefore time.Time
+}
+
+func (s *testRecordingSweepStore) DeleteAllExpiredInboxEvents(ctx context.Context) error {
+	s.mu.Lock()
+	s.numSweeps++
+	s.mu.Unlock()
+
+	return s.Store.DeleteAllExpiredInboxEvents(ctx)
+}
+
+func (s *testRecordingSweepStore) DeleteStaleInboxCursors(ctx context.Context, movedBefore time.Time) error {
+	s.mu.Lock()
+	s.lastMovedBefore = movedBefore
+	s.mu.Unlock()
+
+	return s.Store.DeleteStaleInboxCursors(ctx, movedBefore)
+}
+
+func (s *testRecordingSweepStore) getNumSweeps() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.numSweeps
+}
+
+func (s *testRecordingSweepStore) getLastMovedBefore() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastMovedBefore
+}
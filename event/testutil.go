@@ -1,11 +1,15 @@
 package event
 
 import (
+	"context"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/require"
+
+	commonpb "github.com/code-payments/flipcash-protobuf-api/generated/go/common/v1"
+	eventpb "github.com/code-payments/flipcash-protobuf-api/generated/go/event/v1"
 )
 
 type TestEventObserver[Key, Event any] struct {
@@ -64,3 +68,20 @@ func (h *TestEventObserver[Key, Event]) Reset() {
 
 	h.events = nil
 }
+
+// TestForwarder passes forwarded user events straight to a handler, so tests
+// can observe them without running an event server
+type TestForwarder struct {
+	handler Handler[*commonpb.UserId, *eventpb.Event]
+}
+
+func NewTestForwarder(handler Handler[*commonpb.UserId, *eventpb.Event]) Forwarder {
+	return &TestForwarder{handler: handler}
+}
+
+func (f *TestForwarder) ForwardUserEvents(_ context.Context, events ...*eventpb.UserEvent) error {
+	for _, event := range events {
+		f.handler.OnEvent(event.UserId, event.Event)
+	}
+	return nil
+}
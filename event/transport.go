@@ -0,0 +1,220 @@
+package event
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	eventpb "github.com/code-payments/flipcash-protobuf-api/generated/go/event/v1"
+
+	codeheaders "github.com/code-payments/code-server/pkg/grpc/headers"
+)
+
+// Transport delivers batches of user events, already in their users' inboxes,
+// to the streams hosted at a receiver address. Events for the same user are in
+// the order they were forwarded.
+type Transport interface {
+	// Deliver delivers a batch of user events to the receiver address. Events
+	// the receiver knows it can't deliver are returned, and are left in their
+	// users' inboxes without being retried. An error fails the entire batch,
+	// which is retried.
+	Deliver(ctx context.Context, address string, events []*ForwardedEvent) (undelivered []*ForwardedEvent, err error)
+}
+
+type routingTransport struct {
+	localAddress string
+	local        Transport
+	remote       Transport
+}
+
+// NewRoutingTransport delivers events for the local address over the local
+// transport, and everything else over the remote transport
+func NewRoutingTransport(localAddress string, local, remote Transport) Transport {
+	return &routingTransport{
+		localAddress: localAddress,
+		local:        local,
+		remote:       remote,
+	}
+}
+
+func (t *routingTransport) Deliver(ctx context.Context, address string, events []*ForwardedEvent) ([]*ForwardedEvent, error) {
+	if address == t.localAddress {
+		return t.local.Deliver(ctx, address, events)
+	}
+	return t.remote.Deliver(ctx, address, events)
+}
+
+type rpcTransport struct {
+	log *zap.Logger
+
+	currentRpcApiKey string
+}
+
+// NewRpcTransport forwards events to the server at the receiver address over
+// the internal ForwardEvents RPC. The events' inbox sequences are sent in a
+// header, since the proto doesn't carry them.
+func NewRpcTransport(log *zap.Logger, currentRpcApiKey string) Transport {
+	return &rpcTransport{
+		log: log,
+
+		currentRpcApiKey: currentRpcApiKey,
+	}
+}
+
+func (t *rpcTransport) Deliver(ctx context.Context, address string, events []*ForwardedEvent) ([]*ForwardedEvent, error) {
+	log := t.log.With(zap.String("receiver_address", address))
+
+	var err error
+	if !codeheaders.AreHeadersInitialized(ctx) {
+		ctx, err = codeheaders.ContextWithHeaders(ctx)
+		if err != nil {
+			log.With(zap.Error(err)).Warn("Failure initializing headers")
+			return nil, err
+		}
+	}
+
+	err = codeheaders.SetASCIIHeader(ctx, internalRpcApiKeyHeaderName, t.currentRpcApiKey)
+	if err != nil {
+		log.With(zap.Error(err)).Warn("Failure setting RPC API key header")
+		return nil, err
+	}
+
+	userEvents := make([]*eventpb.UserEvent, len(events))
+	sequences := make([]uint64, len(events))
+	for i, event := range events {
+		userEvents[i] = event.UserEvent
+		sequences[i] = event.Sequence
+	}
+
+	err = codeheaders.SetASCIIHeader(ctx, inboxSequencesHeaderName, encodeInboxSequences(sequences))
+	if err != nil {
+		log.With(zap.Error(err)).Warn("Failure setting inbox sequences header")
+		return nil, err
+	}
+
+	forwardingRpcClient, err := getForwardingRpcClient(address)
+	if err != nil {
+		log.With(zap.Error(err)).Warn("Failure creating forwarding RPC client")
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, forwardRpcTimeout)
+	defer cancel()
+
+	log.With(zap.Int("batch_size", len(events))).Debug("Forwarding events over RPC")
+
+	resp, err := forwardingRpcClient.ForwardEvents(ctx, &eventpb.ForwardEventsRequest{
+		UserEvents: &eventpb.UserEventBatch{
+			Events: userEvents,
+		},
+	})
+	if err != nil {
+		log.With(zap.Error(err)).Warn("Failure forwarding events over RPC")
+		return nil, err
+	} else if resp.Result != eventpb.ForwardEventsResponse_OK {
+		log.With(zap.String("result", resp.Result.String())).Warn("Failure forwarding events over RPC")
+		return nil, errors.Errorf("rpc forward result %s", resp.Result)
+	}
+	return nil, nil
+}
+
+// encodeInboxSequences encodes the inbox sequences of forwarded events, in the
+// order of the events, for the inbox sequences header
+func encodeInboxSequences(sequences []uint64) string {
+	encoded := make([]string, len(sequences))
+	for i, sequence := range sequences {
+		encoded[i] = strconv.FormatUint(sequence, 10)
+	}
+	return strings.Join(encoded, ",")
+}
+
+// decodeInboxSequences decodes the inbox sequences header for a batch of
+// numEvents forwarded events. A missing header decodes to nil, for senders
+// that don't send inbox sequences.
+func decodeInboxSequences(header string, numEvents int) ([]uint64, error) {
+	if len(header) == 0 {
+		return nil, nil
+	}
+
+	encoded := strings.Split(header, ",")
+	if len(encoded) != numEvents {
+		return nil, errors.Errorf("got %d inbox sequences for %d events", len(encoded), numEvents)
+	}
+
+	sequences := make([]uint64, len(encoded))
+	for i, value := range encoded {
+		sequence, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid inbox sequence")
+		}
+		sequences[i] = sequence
+	}
+	return sequences, nil
+}
+
+// InMemoryTransport routes events to transports registered by address within
+// the same process, and records every delivered batch. It's intended for tests.
+type InMemoryTransport struct {
+	mu         sync.RWMutex
+	receivers  map[string]Transport
+	delivered  map[string][][]*ForwardedEvent
+	failNextBy map[string]int
+}
+
+func NewInMemoryTransport() *InMemoryTransport {
+	return &InMemoryTransport{
+		receivers:  make(map[string]Transport),
+		delivered:  make(map[string][][]*ForwardedEvent),
+		failNextBy: make(map[string]int),
+	}
+}
+
+// Register routes events for the address to the receiver. A nil receiver
+// accepts and records every event.
+func (t *InMemoryTransport) Register(address string, receiver Transport) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.receivers[address] = receiver
+}
+
+// FailNext fails the next count deliveries to the address
+func (t *InMemoryTransport) FailNext(address string, count int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.failNextBy[address] = count
+}
+
+// GetDelivered gets the batches delivered to the address, in delivery order
+func (t *InMemoryTransport) GetDelivered(address string) [][]*ForwardedEvent {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return append([][]*ForwardedEvent(nil), t.delivered[address]...)
+}
+
+func (t *InMemoryTransport) Deliver(ctx context.Context, address string, events []*ForwardedEvent) ([]*ForwardedEvent, error) {
+	t.mu.Lock()
+	receiver, ok := t.receivers[address]
+	if !ok {
+		t.mu.Unlock()
+		return nil, errors.Errorf("no receiver at %s", address)
+	}
+	if t.failNextBy[address] > 0 {
+		t.failNextBy[address]--
+		t.mu.Unlock()
+		return nil, errors.Errorf("injected failure delivering to %s", address)
+	}
+	t.delivered[address] = append(t.delivered[address], events)
+	t.mu.Unlock()
+
+	if receiver == nil {
+		return nil, nil
+	}
+	return receiver.Deliver(ctx, address, events)
+}
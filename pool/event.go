@@ -74,19 +74,38 @@ func (h *IntentHandler) OnSuccessfulBetPayment(ctx context.Context, intentRecord
 		return err
 	}
 
-	ts := time.Now()
-	betSummary, bets, err := GetBetSummary(ctx, h.pools, h.codeData, bettingPool)
+	// Marks the bet as paid, which updates the pool's paid bet counts
+	isPaid, err := bet.IsPaid(ctx, h.pools, h.codeData, bettingPool)
 	if err != nil {
 		return err
+	} else if !isPaid {
+		return nil
+	}
+
+	return notifyPoolBetUpdate(ctx, h.pools, h.eventForwarder, bettingPool, time.Now())
+}
+
+// notifyPoolBetUpdate sends the latest bet summary to the pool creator and all
+// bettors
+func notifyPoolBetUpdate(ctx context.Context, pools Store, eventForwarder event.Forwarder, pool *Pool, ts time.Time) error {
+	betSummary, err := GetBetSummary(ctx, pools, pool)
+	if err != nil {
+		return err
+	}
+	protoBetSummary := betSummary.ToProto()
+
+	bets, err := pools.GetBetsByPool(ctx, pool.ID)
+	if err != nil && err != ErrBetNotFound {
+		return err
 	}
 
 	usersToNotify := make(map[string]*commonpb.UserId)
-	usersToNotify[model.UserIDString(bettingPool.CreatorID)] = bettingPool.CreatorID
+	usersToNotify[model.UserIDString(pool.CreatorID)] = pool.CreatorID
 	for _, bet := range bets {
 		usersToNotify[model.UserIDString(bet.UserID)] = bet.UserID
 	}
 
-	userEvents := make([]*eventpb.UserEvent, 0)
+	userEvents := make([]*eventpb.UserEvent, 0, len(usersToNotify))
 	for _, userID := range usersToNotify {
 		userEvents = append(userEvents, &eventpb.UserEvent{
 			UserId: userID,
@@ -95,37 +114,43 @@ func (h *IntentHandler) OnSuccessfulBetPayment(ctx context.Context, intentRecord
 				Ts: timestamppb.New(ts),
 				Type: &eventpb.Event_PoolBetUpdate{
 					PoolBetUpdate: &eventpb.PoolBetUpdateEvent{
-						PoolId:     bettingPool.ID,
-						BetSummary: betSummary,
+						PoolId:     pool.ID,
+						BetSummary: protoBetSummary,
 					},
 				},
 			},
 		})
 	}
-	return h.eventForwarder.ForwardUserEvents(ctx, userEvents...)
+	return eventForwarder.ForwardUserEvents(ctx, userEvents...)
 }
 
-func (s *Server) notifyPoolResolution(ctx context.Context, poolID *poolpb.PoolId, ts time.Time) error {
-	pool, err := s.pools.GetPoolByID(ctx, poolID)
+func notifyPoolResolution(ctx context.Context, pools Store, eventForwarder event.Forwarder, pusher push.Pusher, poolID *poolpb.PoolId, ts time.Time) error {
+	pool, err := pools.GetPoolByID(ctx, poolID)
 	if err != nil {
 		return err
 	}
 
 	verifiedProtoPool := pool.ToProto().VerifiedMetadata
 
-	betSummary, bets, err := GetBetSummary(ctx, s.pools, s.codeData, pool)
+	betSummary, err := GetBetSummary(ctx, pools, pool)
 	if err != nil {
 		return err
 	}
+	protoBetSummary := betSummary.ToProto()
+
+	bets, err := pools.GetBetsByPool(ctx, pool.ID)
+	if err != nil && err != ErrBetNotFound {
+		return err
+	}
 
 	var winners []*commonpb.UserId
 	var losers []*commonpb.UserId
 	var refundedUsers []*commonpb.UserId
 	var winOutcome *poolpb.UserPoolSummary_WinOutcome
 	var loseOutcome *poolpb.UserPoolSummary_LoseOutcome
-	var refundOutcome *poolpb.UserPoolSummary_RefundOutcome
+	userEvents := make([]*eventpb.UserEvent, 0, len(bets))
 	for _, bet := range bets {
-		userSummary, err := getUserSummaryWithCachedBetMetadata(bet.UserID, pool, betSummary, bets)
+		userSummary, err := getUserSummaryForBet(pool, betSummary, bet)
 		if err != nil {
 			return err
 		}
@@ -138,74 +163,40 @@ func (s *Server) notifyPoolResolution(ctx context.Context, poolID *poolpb.PoolId
 			loseOutcome = typed.Lose
 		case *poolpb.UserPoolSummary_Refund:
 			refundedUsers = append(refundedUsers, bet.UserID)
-			refundOutcome = typed.Refund
+		default:
+			// Unpaid bettors have no outcome, and aren't notified
+			continue
 		}
-	}
 
-	if len(winners) > 0 {
-		for _, winner := range winners {
-			s.eventBus.OnEvent(winner, &eventpb.Event{
+		userEvents = append(userEvents, &eventpb.UserEvent{
+			UserId: bet.UserID,
+			Event: &eventpb.Event{
 				Id: event.MustGenerateEventID(),
 				Ts: timestamppb.New(ts),
 				Type: &eventpb.Event_PoolResolved{
 					PoolResolved: &eventpb.PoolResolvedEvent{
-						Pool:       verifiedProtoPool,
-						BetSummary: betSummary,
-						UserSummary: &poolpb.UserPoolSummary{
-							Outcome: &poolpb.UserPoolSummary_Win{
-								Win: winOutcome,
-							},
-						},
+						Pool:        verifiedProtoPool,
+						BetSummary:  protoBetSummary,
+						UserSummary: userSummary,
 					},
 				},
-			})
-		}
+			},
+		})
+	}
 
-		go push.SendWinBettingPoolPushes(ctx, s.pusher, pool.Name, winOutcome.AmountWon, winners...)
+	err = eventForwarder.ForwardUserEvents(ctx, userEvents...)
+	if err != nil {
+		return err
 	}
 
+	if len(winners) > 0 {
+		go push.SendWinBettingPoolPushes(ctx, pusher, pool.Name, winOutcome.AmountWon, winners...)
+	}
 	if len(losers) > 0 {
-		for _, loser := range losers {
-			s.eventBus.OnEvent(loser, &eventpb.Event{
-				Id: event.MustGenerateEventID(),
-				Ts: timestamppb.New(ts),
-				Type: &eventpb.Event_PoolResolved{
-					PoolResolved: &eventpb.PoolResolvedEvent{
-						Pool:       verifiedProtoPool,
-						BetSummary: betSummary,
-						UserSummary: &poolpb.UserPoolSummary{
-							Outcome: &poolpb.UserPoolSummary_Lose{
-								Lose: loseOutcome,
-							},
-						},
-					},
-				},
-			})
-		}
-
-		go push.SendLostBettingPoolPushes(ctx, s.pusher, pool.Name, loseOutcome.AmountLost, losers...)
+		go push.SendLostBettingPoolPushes(ctx, pusher, pool.Name, loseOutcome.AmountLost, losers...)
 	}
-
 	if len(refundedUsers) > 0 {
-		for _, user := range refundedUsers {
-			s.eventBus.OnEvent(user, &eventpb.Event{
-				Id: event.MustGenerateEventID(),
-				Ts: timestamppb.New(ts),
-				Type: &eventpb.Event_PoolResolved{
-					PoolResolved: &eventpb.PoolResolvedEvent{
-						Pool:       verifiedProtoPool,
-						BetSummary: betSummary,
-						UserSummary: &poolpb.UserPoolSummary{
-							Outcome: &poolpb.UserPoolSummary_Refund{
-								Refund: refundOutcome,
-							},
-						},
-					},
-				},
-			})
-		}
-
-		go push.SendTieBettingPoolPushes(ctx, s.pusher, pool.Name, refundedUsers...)
+		go push.SendTieBettingPoolPushes(ctx, pusher, pool.Name, refundedUsers...)
 	}
 
 	return nil
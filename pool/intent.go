@@ -103,54 +103,17 @@ func (h *IntentHandler) ValidateDistribution(ctx context.Context, intentRecord *
 	}
 
 	// Betting pool must be closed and have a resolution in order for payout to occur
-	if bettingPool.IsOpen {
+	betsToPayout, _, err := getBetsToPayout(ctx, h.pools, h.codeData, bettingPool)
+	switch err {
+	case nil:
+	case ErrPoolOpen:
 		return codetransaction.NewIntentValidationError("betting pool is open")
-	}
-	if !bettingPool.HasResolution() {
+	case ErrPoolNotResolved:
 		return codetransaction.NewIntentValidationError("betting pool is not resolved")
-	}
-
-	bets, err := h.pools.GetBetsByPool(ctx, bettingPool.ID)
-	if err == ErrBetNotFound {
-		return codetransaction.NewIntentValidationError("no bets made against betting pool")
-	} else if err != nil {
-		return err
-	}
-
-	var paidBets []*Bet
-	for _, bet := range bets {
-		isPaid, err := bet.IsPaid(ctx, h.pools, h.codeData, bettingPool)
-		if err != nil {
-			return err
-		}
-
-		if isPaid {
-			paidBets = append(paidBets, bet)
-		}
-	}
-
-	var betsToPayout []*Bet
-	for _, bet := range paidBets {
-		switch bettingPool.Resolution {
-		case ResolutionRefunded:
-			betsToPayout = append(betsToPayout, bet)
-		case ResolutionYes:
-			if bet.SelectedOutcome {
-				betsToPayout = append(betsToPayout, bet)
-			}
-		case ResolutionNo:
-			if !bet.SelectedOutcome {
-				betsToPayout = append(betsToPayout, bet)
-			}
-		default:
-			return errors.New("unsupported resolution")
-		}
-	}
-	if len(betsToPayout) == 0 {
-		betsToPayout = paidBets
-	}
-	if len(betsToPayout) == 0 {
+	case ErrNoBetsToPayout:
 		return codetransaction.NewIntentDeniedError("no bets to pay out for pool")
+	default:
+		return err
 	}
 
 	bettingPoolBalance, err := codebalance.CalculateFromCache(ctx, h.codeData, poolAccount)
@@ -162,23 +125,9 @@ func (h *IntentHandler) ValidateDistribution(ctx context.Context, intentRecord *
 	remainingPoolBalance := int64(bettingPoolBalance)
 	seenPayoutDestinations := make(map[string]any)
 	for _, action := range actions {
-		var payoutAmount uint64
-		var payoutDestinationAccount *codecommon.Account
-		switch typed := action.Type.(type) {
-		case *codetransactionpb.Action_NoPrivacyTransfer:
-			payoutAmount = typed.NoPrivacyTransfer.Amount
-			payoutDestinationAccount, err = codecommon.NewAccountFromProto(typed.NoPrivacyTransfer.Destination)
-			if err != nil {
-				return err
-			}
-		case *codetransactionpb.Action_NoPrivacyWithdraw:
-			payoutAmount = typed.NoPrivacyWithdraw.Amount
-			payoutDestinationAccount, err = codecommon.NewAccountFromProto(typed.NoPrivacyWithdraw.Destination)
-			if err != nil {
-				return err
-			}
-		default:
-			return codetransaction.NewActionValidationError(action, "expected a no privacy transfer or withdraw")
+		payoutAmount, payoutDestinationAccount, err := getDistributionPayout(action)
+		if err != nil {
+			return err
 		}
 
 		// Each winning bet should be paid an equal amount
@@ -219,3 +168,22 @@ func (h *IntentHandler) ValidateDistribution(ctx context.Context, intentRecord *
 
 	return nil
 }
+
+func getDistributionPayout(action *codetransactionpb.Action) (uint64, *codecommon.Account, error) {
+	switch typed := action.Type.(type) {
+	case *codetransactionpb.Action_NoPrivacyTransfer:
+		payoutDestinationAccount, err := codecommon.NewAccountFromProto(typed.NoPrivacyTransfer.Destination)
+		if err != nil {
+			return 0, nil, err
+		}
+		return typed.NoPrivacyTransfer.Amount, payoutDestinationAccount, nil
+	case *codetransactionpb.Action_NoPrivacyWithdraw:
+		payoutDestinationAccount, err := codecommon.NewAccountFromProto(typed.NoPrivacyWithdraw.Destination)
+		if err != nil {
+			return 0, nil, err
+		}
+		return typed.NoPrivacyWithdraw.Amount, payoutDestinationAccount, nil
+	default:
+		return 0, nil, codetransaction.NewActionValidationError(action, "expected a no privacy transfer or withdraw")
+	}
+}
@@ -36,10 +36,16 @@ type InMemoryStore struct {
 	pools   []*pool.Pool
 	members []*pool.Member
 	bets    []*pool.Bet
+
+	paidBetCountsByPool map[string][]uint32
+	betLeasesByID       map[string]time.Time
 }
 
 func NewInMemory() pool.Store {
-	return &InMemoryStore{}
+	return &InMemoryStore{
+		paidBetCountsByPool: make(map[string][]uint32),
+		betLeasesByID:       make(map[string]time.Time),
+	}
 }
 
 func (s *InMemoryStore) reset() {
@@ -51,6 +57,9 @@ func (s *InMemoryStore) reset() {
 	s.pools = nil
 	s.members = nil
 	s.bets = nil
+
+	s.paidBetCountsByPool = make(map[string][]uint32)
+	s.betLeasesByID = make(map[string]time.Time)
 }
 
 func (s *InMemoryStore) CreatePool(_ context.Context, newPool *pool.Pool) error {
@@ -92,6 +101,29 @@ func (s *InMemoryStore) ClosePool(_ context.Context, poolID *poolpb.PoolId, clos
 	return nil
 }
 
+func (s *InMemoryStore) MarkRefundOwed(_ context.Context, poolID *poolpb.PoolId) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item := s.findPoolByID(poolID)
+	if item == nil {
+		return pool.ErrPoolNotFound
+	}
+	if item.IsOpen {
+		return pool.ErrPoolOpen
+	}
+	if item.Resolution != pool.ResolutionUnknown {
+		return pool.ErrPoolResolved
+	}
+	if item.IsRefundOwed {
+		return pool.ErrPoolRefundOwed
+	}
+
+	item.IsRefundOwed = true
+
+	return nil
+}
+
 func (s *InMemoryStore) ResolvePool(_ context.Context, poolID *poolpb.PoolId, resolution pool.Resolution, newSignature *commonpb.Signature) error {
 	if resolution == pool.ResolutionUnknown {
 		return errors.New("resolution cannot be unknown")
@@ -129,6 +161,24 @@ func (s *InMemoryStore) GetPoolByID(_ context.Context, poolID *poolpb.PoolId) (*
 	return res.Clone(), nil
 }
 
+func (s *InMemoryStore) GetPoolsByID(_ context.Context, poolIDs []*poolpb.PoolId) ([]*pool.Pool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var res []*pool.Pool
+	for _, poolID := range poolIDs {
+		item := s.findPoolByID(poolID)
+		if item != nil {
+			res = append(res, item.Clone())
+		}
+	}
+
+	if len(res) == 0 {
+		return nil, pool.ErrPoolNotFound
+	}
+	return res, nil
+}
+
 func (s *InMemoryStore) GetPoolByFundingDestination(_ context.Context, fundingDestination *commonpb.PublicKey) (*pool.Pool, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -141,6 +191,62 @@ func (s *InMemoryStore) GetPoolByFundingDestination(_ context.Context, fundingDe
 	return res.Clone(), nil
 }
 
+func (s *InMemoryStore) GetUnresolvedPoolsClosedBefore(_ context.Context, cutoff time.Time, limit int) ([]*pool.Pool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var res []*pool.Pool
+	for _, item := range s.pools {
+		if item.IsOpen || item.HasResolution() || item.IsRefundOwed || item.ClosedAt == nil {
+			continue
+		}
+
+		if !item.ClosedAt.After(cutoff) {
+			res = append(res, item.Clone())
+		}
+	}
+
+	if len(res) == 0 {
+		return nil, pool.ErrPoolNotFound
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].ClosedAt.Before(*res[j].ClosedAt)
+	})
+	if len(res) > limit {
+		res = res[:limit]
+	}
+	return res, nil
+}
+
+func (s *InMemoryStore) GetUnresolvedPools(_ context.Context, cursor *poolpb.PoolId, limit int) ([]*pool.Pool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var res []*pool.Pool
+	for _, item := range s.pools {
+		if item.HasResolution() {
+			continue
+		}
+		if cursor != nil && pool.PoolIDString(item.ID) <= pool.PoolIDString(cursor) {
+			continue
+		}
+		res = append(res, item.Clone())
+	}
+
+	if len(res) == 0 {
+		return nil, pool.ErrPoolNotFound
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		return pool.PoolIDString(res[i].ID) < pool.PoolIDString(res[j].ID)
+	})
+	if len(res) > limit {
+		res = res[:limit]
+	}
+	return res, nil
+}
+
 func (s *InMemoryStore) CreateBet(_ context.Context, newBet *pool.Bet) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -174,9 +280,11 @@ func (s *InMemoryStore) UpdateBetOutcome(_ context.Context, betId *poolpb.BetId,
 		return pool.ErrBetNotFound
 	}
 
+	s.adjustPaidBetCount(item, -1)
 	item.SelectedOutcome = newOutcome
 	item.Signature = proto.Clone(newSignature).(*commonpb.Signature)
 	item.Ts = newTs
+	s.adjustPaidBetCount(item, 1)
 
 	return nil
 }
@@ -189,8 +297,12 @@ func (s *InMemoryStore) MarkBetAsPaid(ctx context.Context, betId *poolpb.BetId)
 	if item == nil {
 		return pool.ErrBetNotFound
 	}
+	if item.IsIntentSubmitted {
+		return pool.ErrBetPaid
+	}
 
 	item.IsIntentSubmitted = true
+	s.adjustPaidBetCount(item, 1)
 
 	return nil
 }
@@ -231,6 +343,131 @@ func (s *InMemoryStore) GetBetsByPool(_ context.Context, poolID *poolpb.PoolId)
 	return pool.CloneBets(res), nil
 }
 
+func (s *InMemoryStore) GetBetsByUserAndPools(_ context.Context, userID *commonpb.UserId, poolIDs []*poolpb.PoolId) ([]*pool.Bet, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var res []*pool.Bet
+	for _, poolID := range poolIDs {
+		item := s.findBetByPoolAndUser(poolID, userID)
+		if item != nil {
+			res = append(res, item.Clone())
+		}
+	}
+
+	if len(res) == 0 {
+		return nil, pool.ErrBetNotFound
+	}
+	return res, nil
+}
+
+func (s *InMemoryStore) ClaimUnpaidBetsOnUnresolvedPools(_ context.Context, leaseDuration time.Duration, limit int) ([]*pool.Bet, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	var claimable []*pool.Bet
+	for _, item := range s.bets {
+		if item.IsIntentSubmitted {
+			continue
+		}
+		if leaseExpiresAt, ok := s.betLeasesByID[pool.BetIDString(item.ID)]; ok && leaseExpiresAt.After(now) {
+			continue
+		}
+
+		bettingPool := s.findPoolByID(item.PoolID)
+		if bettingPool == nil || bettingPool.HasResolution() {
+			continue
+		}
+
+		claimable = append(claimable, item)
+	}
+
+	if len(claimable) == 0 {
+		return nil, pool.ErrBetNotFound
+	}
+
+	sort.SliceStable(claimable, func(i, j int) bool {
+		return pool.BetIDString(claimable[i].ID) < pool.BetIDString(claimable[j].ID)
+	})
+	if len(claimable) > limit {
+		claimable = claimable[:limit]
+	}
+
+	res := make([]*pool.Bet, len(claimable))
+	for i, item := range claimable {
+		s.betLeasesByID[pool.BetIDString(item.ID)] = now.Add(leaseDuration)
+		res[i] = item.Clone()
+	}
+	return res, nil
+}
+
+func (s *InMemoryStore) GetPaidBetCounts(_ context.Context, poolID *poolpb.PoolId) ([]uint32, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts := s.paidBetCountsByPool[pool.PoolIDString(poolID)]
+	res := make([]uint32, len(counts))
+	copy(res, counts)
+	return res, nil
+}
+
+func (s *InMemoryStore) GetPaidBetCountsByPools(_ context.Context, poolIDs []*poolpb.PoolId) (map[string][]uint32, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	res := make(map[string][]uint32)
+	for _, poolID := range poolIDs {
+		key := pool.PoolIDString(poolID)
+
+		counts, ok := s.paidBetCountsByPool[key]
+		if !ok {
+			continue
+		}
+
+		res[key] = make([]uint32, len(counts))
+		copy(res[key], counts)
+	}
+	return res, nil
+}
+
+func (s *InMemoryStore) RepairPaidBetCounts(_ context.Context, poolID *poolpb.PoolId) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item := s.findPoolByID(poolID)
+	if item == nil {
+		return false, pool.ErrPoolNotFound
+	}
+
+	expected := make([]uint32, pool.NumBooleanOutcomes)
+	for _, bet := range s.findBetsByPool(poolID) {
+		if !bet.IsIntentSubmitted {
+			continue
+		}
+
+		outcome := bet.Outcome()
+		if int(outcome) >= len(expected) {
+			return false, errors.New("bet outcome out of range")
+		}
+		expected[outcome]++
+	}
+
+	key := pool.PoolIDString(poolID)
+	actual := s.paidBetCountsByPool[key]
+
+	isRepaired := len(actual) > len(expected)
+	for i := range expected {
+		if i >= len(actual) || actual[i] != expected[i] {
+			isRepaired = true
+		}
+	}
+
+	s.paidBetCountsByPool[key] = expected
+	return isRepaired, nil
+}
+
 func (s *InMemoryStore) GetMember(_ context.Context, poolID *poolpb.PoolId, userID *commonpb.UserId) (*pool.Member, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -340,6 +577,36 @@ func (s *InMemoryStore) addMemberIfNotFound(userID *commonpb.UserId, poolID *poo
 	s.members = append(s.members, member)
 }
 
+// adjustPaidBetCount updates the paid bet count for the bet's outcome, if the
+// bet currently counts towards it. Bets for unknown pools are ignored.
+func (s *InMemoryStore) adjustPaidBetCount(bet *pool.Bet, delta int) {
+	if !bet.IsIntentSubmitted {
+		return
+	}
+
+	item := s.findPoolByID(bet.PoolID)
+	if item == nil {
+		return
+	}
+
+	key := pool.PoolIDString(bet.PoolID)
+	counts := s.paidBetCountsByPool[key]
+	for len(counts) < pool.NumBooleanOutcomes {
+		counts = append(counts, 0)
+	}
+
+	outcome := bet.Outcome()
+	if int(outcome) >= len(counts) {
+		return
+	}
+	if delta < 0 && counts[outcome] == 0 {
+		return
+	}
+	counts[outcome] = uint32(int(counts[outcome]) + delta)
+
+	s.paidBetCountsByPool[key] = counts
+}
+
 func (s *InMemoryStore) findBetByID(betID *poolpb.BetId) *pool.Bet {
 	for _, bet := range s.bets {
 		if bytes.Equal(bet.ID.Value, betID.Value) {
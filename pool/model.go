@@ -33,6 +33,14 @@ const (
 	ResolutionNo
 )
 
+// Outcome indices used to count bets in yes/no pools
+const (
+	BooleanOutcomeYes uint32 = iota
+	BooleanOutcomeNo
+
+	NumBooleanOutcomes = 2
+)
+
 type Pool struct {
 	ID                 *poolpb.PoolId
 	CreatorID          *commonpb.UserId
@@ -42,6 +50,7 @@ type Pool struct {
 	FundingDestination *commonpb.PublicKey
 	IsOpen             bool
 	Resolution         Resolution
+	IsRefundOwed       bool // Set when the creator missed the resolution deadline
 	CreatedAt          time.Time
 	ClosedAt           *time.Time
 	Signature          *commonpb.Signature
@@ -73,6 +82,18 @@ func (p *Pool) HasResolution() bool {
 	return p.Resolution != ResolutionUnknown
 }
 
+// WinningOutcome returns the index of the winning outcome. False is returned
+// when the pool is unresolved or refunded.
+func (p *Pool) WinningOutcome() (uint32, bool) {
+	switch p.Resolution {
+	case ResolutionYes:
+		return BooleanOutcomeYes, true
+	case ResolutionNo:
+		return BooleanOutcomeNo, true
+	}
+	return 0, false
+}
+
 func (p *Pool) Clone() *Pool {
 	cloned := &Pool{
 		ID:                 proto.Clone(p.ID).(*poolpb.PoolId),
@@ -83,6 +104,7 @@ func (p *Pool) Clone() *Pool {
 		FundingDestination: proto.Clone(p.FundingDestination).(*commonpb.PublicKey),
 		IsOpen:             p.IsOpen,
 		Resolution:         p.Resolution,
+		IsRefundOwed:       p.IsRefundOwed,
 		CreatedAt:          p.CreatedAt,
 		Signature:          proto.Clone(p.Signature).(*commonpb.Signature),
 	}
@@ -227,6 +249,23 @@ func (b *Bet) IsPaid(ctx context.Context, pools Store, codeData codedata.Provide
 		return true, nil
 	}
 
+	hasPaymentIntent, err := b.hasPaymentIntent(ctx, codeData, pool)
+	if err != nil || !hasPaymentIntent {
+		return false, err
+	}
+
+	err = pools.MarkBetAsPaid(ctx, b.ID)
+	if err != nil && err != ErrBetPaid {
+		return false, err
+	}
+	b.IsIntentSubmitted = true
+
+	return true, nil
+}
+
+// hasPaymentIntent returns whether a valid payment intent for the bet was
+// submitted to code-server
+func (b *Bet) hasPaymentIntent(ctx context.Context, codeData codedata.Provider, pool *Pool) (bool, error) {
 	intentId, err := codecommon.NewAccountFromPublicKeyBytes(b.ID.Value)
 	if err != nil {
 		return false, err
@@ -261,14 +300,15 @@ func (b *Bet) IsPaid(ctx context.Context, pools Store, codeData codedata.Provide
 	if intentRecord.State == codeintent.StateRevoked {
 		return false, nil
 	}
+	return true, nil
+}
 
-	err = pools.MarkBetAsPaid(ctx, b.ID)
-	if err != nil {
-		return false, err
+// Outcome returns the index of the outcome the bet was placed on
+func (b *Bet) Outcome() uint32 {
+	if b.SelectedOutcome {
+		return BooleanOutcomeYes
 	}
-	b.IsIntentSubmitted = true
-
-	return true, nil
+	return BooleanOutcomeNo
 }
 
 func (b *Bet) Clone() *Bet {
@@ -309,6 +349,48 @@ func (b *Bet) ToProto() *poolpb.BetMetadata {
 	}
 }
 
+// BetSummary is a summary of paid bets made against a pool
+type BetSummary struct {
+	Currency         string
+	NumBetsByOutcome []uint32 // Indexed by outcome
+	TotalAmountBet   float64
+}
+
+// NumBets returns the total number of paid bets across all outcomes
+func (s *BetSummary) NumBets() int {
+	var res int
+	for _, count := range s.NumBetsByOutcome {
+		res += int(count)
+	}
+	return res
+}
+
+// NumBetsForOutcome returns the number of paid bets for the provided outcome
+func (s *BetSummary) NumBetsForOutcome(outcome uint32) int {
+	if int(outcome) >= len(s.NumBetsByOutcome) {
+		return 0
+	}
+	return int(s.NumBetsByOutcome[outcome])
+}
+
+func (s *BetSummary) ToProto() *poolpb.BetSummary {
+	proto := &poolpb.BetSummary{
+		TotalAmountBet: &commonpb.FiatPaymentAmount{
+			Currency:     s.Currency,
+			NativeAmount: s.TotalAmountBet,
+		},
+	}
+
+	proto.Kind = &poolpb.BetSummary_BooleanSummary{
+		BooleanSummary: &poolpb.BetSummary_BooleanBetSummary{
+			NumYes: uint32(s.NumBetsForOutcome(BooleanOutcomeYes)),
+			NumNo:  uint32(s.NumBetsForOutcome(BooleanOutcomeNo)),
+		},
+	}
+
+	return proto
+}
+
 func VerifyPoolSignature(log *zap.Logger, signedPool *poolpb.SignedPoolMetadata, signature *commonpb.Signature) bool {
 	isVerified := verifySignedMetadata(signedPool.Id, signedPool, signature)
 	if !isVerified {
@@ -0,0 +1,175 @@
+package pool
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sort"
+
+	commonpb "github.com/code-payments/flipcash-protobuf-api/generated/go/common/v1"
+	poolpb "github.com/code-payments/flipcash-protobuf-api/generated/go/pool/v1"
+
+	codebalance "github.com/code-payments/code-server/pkg/code/balance"
+	codecommon "github.com/code-payments/code-server/pkg/code/common"
+	codedata "github.com/code-payments/code-server/pkg/code/data"
+)
+
+var (
+	ErrPoolNotResolved = errors.New("pool is not resolved")
+	ErrNoBetsToPayout  = errors.New("no bets to pay out for pool")
+)
+
+type PayoutKind int
+
+const (
+	PayoutKindUnknown PayoutKind = iota
+	PayoutKindWinnings
+	PayoutKindRefund
+)
+
+// Payout is a single transfer out of a pool's funding destination
+type Payout struct {
+	Kind        PayoutKind
+	Destination *commonpb.PublicKey
+	Quarks      uint64
+}
+
+// PayoutPlan is the set of payouts that evenly distributes a resolved pool's
+// balance, including any remainder
+type PayoutPlan struct {
+	PoolID   *poolpb.PoolId
+	IsRefund bool   // Paid bets are refunded, either by resolution or because no bet won
+	Balance  uint64 // Cached balance of the pool's funding destination, in quarks
+	Payouts  []*Payout
+}
+
+// GetPayoutPlan computes the payout plan for a resolved pool from its cached
+// balance.
+//
+// The balance is split evenly across the bets being paid out. Any remainder is
+// spread one quark at a time across bets ordered by ID, so every server
+// computes the same plan. Payouts to the same destination are merged.
+//
+// todo: Serve to pool creators when a payout plan RPC is available in the pool proto API
+func GetPayoutPlan(ctx context.Context, pools Store, codeData codedata.Provider, pool *Pool) (*PayoutPlan, error) {
+	betsToPayout, isRefund, err := getBetsToPayout(ctx, pools, codeData, pool)
+	if err != nil {
+		return nil, err
+	}
+
+	poolAccount, err := codecommon.NewAccountFromPublicKeyBytes(pool.FundingDestination.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	balance, err := codebalance.CalculateFromCache(ctx, codeData, poolAccount)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &PayoutPlan{
+		PoolID:   pool.ID,
+		IsRefund: isRefund,
+		Balance:  balance,
+	}
+
+	payoutKind := PayoutKindWinnings
+	if isRefund {
+		payoutKind = PayoutKindRefund
+	}
+
+	sort.Slice(betsToPayout, func(i, j int) bool {
+		return bytes.Compare(betsToPayout[i].ID.Value, betsToPayout[j].ID.Value) < 0
+	})
+
+	payoutAmount := balance / uint64(len(betsToPayout))
+	remainder := balance % uint64(len(betsToPayout))
+
+	payoutsByDestination := make(map[string]*Payout)
+	for i, bet := range betsToPayout {
+		quarks := payoutAmount
+		if uint64(i) < remainder {
+			quarks++
+		}
+
+		key := string(bet.PayoutDestination.Value)
+		if payout, ok := payoutsByDestination[key]; ok {
+			payout.Quarks += quarks
+			continue
+		}
+
+		payout := &Payout{
+			Kind:        payoutKind,
+			Destination: bet.PayoutDestination,
+			Quarks:      quarks,
+		}
+		payoutsByDestination[key] = payout
+		plan.Payouts = append(plan.Payouts, payout)
+	}
+
+	// Pools with fewer quarks than bets to pay out can't pay everyone, and
+	// zero amount transfers aren't allowed
+	var nonZeroPayouts []*Payout
+	for _, payout := range plan.Payouts {
+		if payout.Quarks > 0 {
+			nonZeroPayouts = append(nonZeroPayouts, payout)
+		}
+	}
+	plan.Payouts = nonZeroPayouts
+
+	return plan, nil
+}
+
+// getBetsToPayout gets the paid bets a resolved pool's balance is distributed
+// to. Paid bets are refunded when the pool is refunded or no bet won.
+func getBetsToPayout(ctx context.Context, pools Store, codeData codedata.Provider, pool *Pool) ([]*Bet, bool, error) {
+	if pool.IsOpen {
+		return nil, false, ErrPoolOpen
+	}
+	if !pool.HasResolution() {
+		return nil, false, ErrPoolNotResolved
+	}
+
+	bets, err := pools.GetBetsByPool(ctx, pool.ID)
+	if err == ErrBetNotFound {
+		return nil, false, ErrNoBetsToPayout
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	var paidBets []*Bet
+	for _, bet := range bets {
+		isPaid, err := bet.IsPaid(ctx, pools, codeData, pool)
+		if err != nil {
+			return nil, false, err
+		}
+
+		if isPaid {
+			paidBets = append(paidBets, bet)
+		}
+	}
+
+	var betsToPayout []*Bet
+	for _, bet := range paidBets {
+		switch pool.Resolution {
+		case ResolutionRefunded:
+			betsToPayout = append(betsToPayout, bet)
+		case ResolutionYes, ResolutionNo:
+			winningOutcome, _ := pool.WinningOutcome()
+			if bet.Outcome() == winningOutcome {
+				betsToPayout = append(betsToPayout, bet)
+			}
+		default:
+			return nil, false, errors.New("unsupported resolution")
+		}
+	}
+	isRefund := pool.Resolution == ResolutionRefunded
+	if len(betsToPayout) == 0 {
+		isRefund = true
+		betsToPayout = paidBets
+	}
+	if len(betsToPayout) == 0 {
+		return nil, false, ErrNoBetsToPayout
+	}
+	return betsToPayout, isRefund, nil
+}
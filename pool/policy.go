@@ -0,0 +1,110 @@
+package pool
+
+import (
+	"context"
+	"fmt"
+
+	commonpb "github.com/code-payments/flipcash-protobuf-api/generated/go/common/v1"
+
+	codecurrencyutil "github.com/code-payments/code-server/pkg/code/currency"
+	codedata "github.com/code-payments/code-server/pkg/code/data"
+	codecurrencydata "github.com/code-payments/code-server/pkg/code/data/currency"
+	codecurrency "github.com/code-payments/code-server/pkg/currency"
+	"github.com/code-payments/flipcash-server/account"
+)
+
+// BuyInLimits are the USD bounds for a pool's buy in amount. A zero bound isn't
+// enforced.
+type BuyInLimits struct {
+	MinUsd float64
+	MaxUsd float64
+}
+
+func (l BuyInLimits) isUnlimited() bool {
+	return l.MinUsd == 0 && l.MaxUsd == 0
+}
+
+type BuyInPolicyConfig struct {
+	AllowedCurrencies []codecurrency.Code // Any currency with an exchange rate is allowed when empty
+	UserLimits        BuyInLimits
+	StaffLimits       BuyInLimits
+}
+
+// DefaultBuyInPolicyConfig allows any buy in, as CreatePool did before the
+// policy existed
+var DefaultBuyInPolicyConfig = BuyInPolicyConfig{}
+
+// BuyInPolicy enforces per-currency buy in limits for new pools. Limits are
+// defined in USD and converted to the pool's currency using the latest
+// exchange rate.
+type BuyInPolicy struct {
+	accounts account.Store
+
+	codeData codedata.Provider
+
+	allowedCurrencies map[codecurrency.Code]struct{}
+	userLimits        BuyInLimits
+	staffLimits       BuyInLimits
+}
+
+func NewBuyInPolicy(accounts account.Store, codeData codedata.Provider, config BuyInPolicyConfig) *BuyInPolicy {
+	allowedCurrencies := make(map[codecurrency.Code]struct{})
+	for _, currency := range config.AllowedCurrencies {
+		allowedCurrencies[currency] = struct{}{}
+	}
+
+	return &BuyInPolicy{
+		accounts: accounts,
+
+		codeData: codeData,
+
+		allowedCurrencies: allowedCurrencies,
+		userLimits:        config.UserLimits,
+		staffLimits:       config.StaffLimits,
+	}
+}
+
+// AllowBuyIn determines whether the user can create a pool with the provided
+// buy in. When the buy in isn't allowed, a user-facing reason is returned.
+func (p *BuyInPolicy) AllowBuyIn(ctx context.Context, userID *commonpb.UserId, buyIn *commonpb.FiatPaymentAmount) (bool, string, error) {
+	currency := codecurrency.Code(buyIn.Currency)
+	if len(p.allowedCurrencies) > 0 {
+		if _, ok := p.allowedCurrencies[currency]; !ok {
+			return false, fmt.Sprintf("%s is not a supported buy in currency", buyIn.Currency), nil
+		}
+	}
+
+	isStaff, err := p.accounts.IsStaff(ctx, userID)
+	if err != nil {
+		return false, "", err
+	}
+
+	limits := p.userLimits
+	if isStaff {
+		limits = p.staffLimits
+	}
+	if limits.isUnlimited() {
+		return true, "", nil
+	}
+
+	exchangeRate := 1.0
+	if currency != codecurrency.USD {
+		exchangeRateRecord, err := p.codeData.GetExchangeRate(ctx, currency, codecurrencyutil.GetLatestExchangeRateTime())
+		if err == codecurrencydata.ErrNotFound {
+			return false, fmt.Sprintf("exchange rate for %s is unavailable", buyIn.Currency), nil
+		} else if err != nil {
+			return false, "", err
+		}
+		exchangeRate = exchangeRateRecord.Rate
+	}
+
+	minAmount := limits.MinUsd * exchangeRate
+	maxAmount := limits.MaxUsd * exchangeRate
+	if limits.MinUsd > 0 && buyIn.NativeAmount < minAmount {
+		return false, fmt.Sprintf("buy in amount minimum is %.2f %s", minAmount, buyIn.Currency), nil
+	}
+	if limits.MaxUsd > 0 && buyIn.NativeAmount > maxAmount {
+		return false, fmt.Sprintf("buy in amount maximum is %.2f %s", maxAmount, buyIn.Currency), nil
+	}
+	return true, "", nil
+}
@@ -23,12 +23,15 @@ import (
 
 const (
 	poolsTableName = "flipcash_pools"
-	allPoolFields  = `"id", "creatorId", "name", "buyInCurrency", "buyInAmount", "fundingDestination", "isOpen", "resolution", "signature", "createdAt", "closedAt", "updatedAt"`
+	allPoolFields  = `"id", "creatorId", "name", "buyInCurrency", "buyInAmount", "fundingDestination", "isOpen", "resolution", "isRefundOwed", "signature", "createdAt", "closedAt", "updatedAt"`
 
 	membersTableName         = "flipcash_poolmembers"
 	allMemberFields          = `"id", ` + allMemberFieldsWithoutId
 	allMemberFieldsWithoutId = `"poolId", "userId", "createdAt", "updatedAt"`
 
+	paidBetCountsTableName = "flipcash_paidbetcounts"
+	allPaidBetCountFields  = `"poolId", "outcome", "numPaidBets", "createdAt", "updatedAt"`
+
 	betsTableName = "flipcash_bets"
 	allBetFields  = `"id", "poolId", "userId", "selectedOutcome", "payoutDestination", "isIntentSubmitted", "signature", "createdAt", "updatedAt"`
 )
@@ -42,6 +45,7 @@ type poolModel struct {
 	FundingDestination string       `db:"fundingDestination"`
 	IsOpen             bool         `db:"isOpen"`
 	Resolution         int          `db:"resolution"`
+	IsRefundOwed       bool         `db:"isRefundOwed"`
 	Signature          string       `db:"signature"`
 	CreatedAt          time.Time    `db:"createdAt"`
 	ClosedAt           sql.NullTime `db:"closedAt"`
@@ -64,6 +68,7 @@ func toPoolModel(p *pool.Pool) *poolModel {
 		FundingDestination: pg.Encode(p.FundingDestination.Value, pg.Base58),
 		IsOpen:             p.IsOpen,
 		Resolution:         int(p.Resolution),
+		IsRefundOwed:       p.IsRefundOwed,
 		Signature:          pg.Encode(p.Signature.Value, pg.Base58),
 		CreatedAt:          p.CreatedAt,
 		ClosedAt:           closedAt,
@@ -105,6 +110,7 @@ func fromPoolModel(m *poolModel) (*pool.Pool, error) {
 		FundingDestination: &commonpb.PublicKey{Value: decodedFundingDestination},
 		IsOpen:             m.IsOpen,
 		Resolution:         pool.Resolution(m.Resolution),
+		IsRefundOwed:       m.IsRefundOwed,
 		Signature:          &commonpb.Signature{Value: decodedSignature},
 		CreatedAt:          m.CreatedAt,
 		ClosedAt:           closedAt,
@@ -147,6 +153,25 @@ func fromMemberModel(m *memberModel) (*pool.Member, error) {
 	}, nil
 }
 
+type paidBetCountModel struct {
+	PoolID      string    `db:"poolId"`
+	Outcome     int64     `db:"outcome"`
+	NumPaidBets int64     `db:"numPaidBets"`
+	CreatedAt   time.Time `db:"createdAt"`
+	UpdatedAt   time.Time `db:"updatedAt"`
+}
+
+func fromPaidBetCountModels(models []*paidBetCountModel) []uint32 {
+	var res []uint32
+	for _, m := range models {
+		for len(res) <= int(m.Outcome) {
+			res = append(res, 0)
+		}
+		res[m.Outcome] = uint32(m.NumPaidBets)
+	}
+	return res
+}
+
 type betModel struct {
 	ID                string    `db:"id"`
 	PoolID            string    `db:"poolId"`
@@ -213,7 +238,7 @@ func fromBetModel(m *betModel) (*pool.Bet, error) {
 func (m *poolModel) dbPut(ctx context.Context, pgxPool *pgxpool.Pool) error {
 	return pg.ExecuteInTx(ctx, pgxPool, func(tx pgx.Tx) error {
 		query := `INSERT INTO ` + poolsTableName + `(` + allPoolFields + `)
-			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, NOW())
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, NOW())
 			RETURNING ` + allPoolFields
 		err := pgxscan.Get(
 			ctx,
@@ -228,6 +253,7 @@ func (m *poolModel) dbPut(ctx context.Context, pgxPool *pgxpool.Pool) error {
 			m.FundingDestination,
 			m.IsOpen,
 			m.Resolution,
+			m.IsRefundOwed,
 			m.Signature,
 			m.CreatedAt,
 			m.ClosedAt,
@@ -362,6 +388,41 @@ func dbResolvePool(ctx context.Context, pgxPool *pgxpool.Pool, poolID *poolpb.Po
 	})
 }
 
+func dbMarkRefundOwed(ctx context.Context, pgxPool *pgxpool.Pool, poolID *poolpb.PoolId) error {
+	return pg.ExecuteInTx(ctx, pgxPool, func(tx pgx.Tx) error {
+		query := `UPDATE ` + poolsTableName + `
+			SET "isRefundOwed" = TRUE, "updatedAt" = NOW()
+			WHERE "id" = $1 AND "isOpen" = FALSE AND "resolution" = $2 AND "isRefundOwed" = FALSE`
+		cmd, err := tx.Exec(
+			ctx,
+			query,
+			pg.Encode(poolID.Value, pg.Base58),
+			pool.ResolutionUnknown,
+		)
+		if err != nil {
+			return err
+		}
+		if cmd.RowsAffected() == 0 {
+			existing, err := dbGetPoolByID(ctx, pgxPool, poolID)
+			switch err {
+			case nil:
+				if existing.IsOpen {
+					return pool.ErrPoolOpen
+				}
+				if pool.Resolution(existing.Resolution) != pool.ResolutionUnknown {
+					return pool.ErrPoolResolved
+				}
+				return pool.ErrPoolRefundOwed
+			case pool.ErrPoolNotFound:
+				return pool.ErrPoolNotFound
+			default:
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 func dbGetPoolByID(ctx context.Context, pgxPool *pgxpool.Pool, poolID *poolpb.PoolId) (*poolModel, error) {
 	res := &poolModel{}
 	query := `SELECT ` + allPoolFields + ` FROM ` + poolsTableName + ` WHERE "id" = $1`
@@ -381,6 +442,28 @@ func dbGetPoolByID(ctx context.Context, pgxPool *pgxpool.Pool, poolID *poolpb.Po
 	return res, nil
 }
 
+func dbGetPoolsByID(ctx context.Context, pgxPool *pgxpool.Pool, poolIDs []*poolpb.PoolId) ([]*poolModel, error) {
+	var res []*poolModel
+	query := `SELECT ` + allPoolFields + ` FROM ` + poolsTableName + ` WHERE "id" = ANY($1)`
+	err := pgxscan.Select(
+		ctx,
+		pgxPool,
+		&res,
+		query,
+		encodePoolIDs(poolIDs),
+	)
+	if err != nil {
+		if pgxscan.NotFound(err) {
+			return nil, pool.ErrPoolNotFound
+		}
+		return nil, err
+	}
+	if len(res) == 0 {
+		return nil, pool.ErrPoolNotFound
+	}
+	return res, nil
+}
+
 func dbGetPoolByFundingDestination(ctx context.Context, pgxPool *pgxpool.Pool, fundingDestination *commonpb.PublicKey) (*poolModel, error) {
 	res := &poolModel{}
 	query := `SELECT ` + allPoolFields + ` FROM ` + poolsTableName + ` WHERE "fundingDestination" = $1`
@@ -400,14 +483,62 @@ func dbGetPoolByFundingDestination(ctx context.Context, pgxPool *pgxpool.Pool, f
 	return res, nil
 }
 
+func dbGetUnresolvedPoolsClosedBefore(ctx context.Context, pgxPool *pgxpool.Pool, cutoff time.Time, limit int) ([]*poolModel, error) {
+	var res []*poolModel
+	query := `SELECT ` + allPoolFields + ` FROM ` + poolsTableName + `
+		WHERE "isOpen" = FALSE AND "resolution" = $1 AND "isRefundOwed" = FALSE AND "closedAt" <= $2
+		ORDER BY "closedAt" ASC
+		LIMIT $3`
+	err := pgxscan.Select(
+		ctx,
+		pgxPool,
+		&res,
+		query,
+		pool.ResolutionUnknown,
+		cutoff,
+		limit,
+	)
+	if err != nil {
+		if pgxscan.NotFound(err) {
+			return nil, pool.ErrPoolNotFound
+		}
+		return nil, err
+	}
+	if len(res) == 0 {
+		return nil, pool.ErrPoolNotFound
+	}
+	return res, nil
+}
+
 func dbUpdateBetOutcome(ctx context.Context, pgxPool *pgxpool.Pool, betID *poolpb.BetId, newOutcome bool, newSignature *commonpb.Signature, newTs time.Time) error {
 	return pg.ExecuteInTx(ctx, pgxPool, func(tx pgx.Tx) error {
-		query := `UPDATE ` + betsTableName + `
-			SET  "selectedOutcome" = $2, "signature" = $3, "createdAt" = $4
-			WHERE "id" = $1`
+		existing := &betModel{}
+		query := `SELECT ` + allBetFields + ` FROM ` + betsTableName + `
+			WHERE "id" = $1
+			FOR UPDATE`
+		err := pgxscan.Get(
+			ctx,
+			tx,
+			existing,
+			query,
+			pg.Encode(betID.Value, pg.Base58),
+		)
+		if err != nil {
+			if pgxscan.NotFound(err) {
+				return pool.ErrBetNotFound
+			}
+			return err
+		}
 
-		cmd, err := tx.Exec(
+		updated := &betModel{}
+		query = `UPDATE ` + betsTableName + `
+			SET  "selectedOutcome" = $2, "signature" = $3, "createdAt" = $4
+			WHERE "id" = $1
+			RETURNING ` + allBetFields
+		err = pgxscan.Get(
 			ctx,
+			tx,
+			updated,
 			query,
 			pg.Encode(betID.Value, pg.Base58),
 			newOutcome,
@@ -415,33 +546,49 @@ func dbUpdateBetOutcome(ctx context.Context, pgxPool *pgxpool.Pool, betID *poolp
 			newTs,
 		)
 		if err != nil {
+			if pgxscan.NotFound(err) {
+				return pool.ErrBetNotFound
+			}
 			return err
 		}
-		if cmd.RowsAffected() == 0 {
-			return pool.ErrBetNotFound
+
+		err = dbAdjustPaidBetCount(ctx, tx, existing, -1)
+		if err != nil {
+			return err
 		}
-		return nil
+		return dbAdjustPaidBetCount(ctx, tx, updated, 1)
 	})
 }
 
 func dbMarkBetAsPaid(ctx context.Context, pgxPool *pgxpool.Pool, betID *poolpb.BetId) error {
 	return pg.ExecuteInTx(ctx, pgxPool, func(tx pgx.Tx) error {
+		updated := &betModel{}
 		query := `UPDATE ` + betsTableName + `
 			SET  "isIntentSubmitted" = TRUE
-			WHERE "id" = $1`
-
-		cmd, err := tx.Exec(
+			WHERE "id" = $1 AND "isIntentSubmitted" = FALSE
+			RETURNING ` + allBetFields
+		err := pgxscan.Get(
 			ctx,
+			tx,
+			updated,
 			query,
 			pg.Encode(betID.Value, pg.Base58),
 		)
-		if err != nil {
+		if pgxscan.NotFound(err) {
+			_, err := dbGetBetByID(ctx, pgxPool, betID)
+			switch err {
+			case nil:
+				return pool.ErrBetPaid
+			case pool.ErrBetNotFound:
+				return pool.ErrBetNotFound
+			default:
+				return err
+			}
+		} else if err != nil {
 			return err
 		}
-		if cmd.RowsAffected() == 0 {
-			return pool.ErrBetNotFound
-		}
-		return nil
+
+		return dbAdjustPaidBetCount(ctx, tx, updated, 1)
 	})
 }
 
@@ -509,6 +656,264 @@ func dbGetBetsByPool(ctx context.Context, pgxPool *pgxpool.Pool, poolID *poolpb.
 	return res, nil
 }
 
+func dbClaimUnpaidBetsOnUnresolvedPools(ctx context.Context, pgxPool *pgxpool.Pool, leaseDuration time.Duration, limit int) ([]*betModel, error) {
+	now := time.Now()
+
+	var res []*betModel
+	query := `UPDATE ` + betsTableName + `
+		SET "reconcileLeaseExpiresAt" = $1
+		WHERE "id" IN (
+			SELECT "id" FROM ` + betsTableName + `
+			WHERE "isIntentSubmitted" = FALSE
+				AND ("reconcileLeaseExpiresAt" IS NULL OR "reconcileLeaseExpiresAt" <= $2)
+				AND "poolId" IN (SELECT "id" FROM ` + poolsTableName + ` WHERE "resolution" = $3)
+			ORDER BY "id" ASC
+			LIMIT $4
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + allBetFields
+	err := pgxscan.Select(
+		ctx,
+		pgxPool,
+		&res,
+		query,
+		now.Add(leaseDuration),
+		now,
+		pool.ResolutionUnknown,
+		limit,
+	)
+	if err != nil {
+		if pgxscan.NotFound(err) {
+			return nil, pool.ErrBetNotFound
+		}
+		return nil, err
+	}
+	if len(res) == 0 {
+		return nil, pool.ErrBetNotFound
+	}
+	return res, nil
+}
+
+func dbGetPaidBetCounts(ctx context.Context, pgxPool *pgxpool.Pool, poolID *poolpb.PoolId) ([]uint32, error) {
+	var res []*paidBetCountModel
+	query := `SELECT ` + allPaidBetCountFields + ` FROM ` + paidBetCountsTableName + `
+		WHERE "poolId" = $1`
+	err := pgxscan.Select(
+		ctx,
+		pgxPool,
+		&res,
+		query,
+		pg.Encode(poolID.Value, pg.Base58),
+	)
+	if err != nil && !pgxscan.NotFound(err) {
+		return nil, err
+	}
+	return fromPaidBetCountModels(res), nil
+}
+
+func dbGetPaidBetCountsByPools(ctx context.Context, pgxPool *pgxpool.Pool, poolIDs []*poolpb.PoolId) (map[string][]uint32, error) {
+	var models []*paidBetCountModel
+	query := `SELECT ` + allPaidBetCountFields + ` FROM ` + paidBetCountsTableName + `
+		WHERE "poolId" = ANY($1)`
+	err := pgxscan.Select(
+		ctx,
+		pgxPool,
+		&models,
+		query,
+		encodePoolIDs(poolIDs),
+	)
+	if err != nil && !pgxscan.NotFound(err) {
+		return nil, err
+	}
+
+	modelsByPool := make(map[string][]*paidBetCountModel)
+	for _, model := range models {
+		modelsByPool[model.PoolID] = append(modelsByPool[model.PoolID], model)
+	}
+
+	res := make(map[string][]uint32)
+	for encodedPoolID, models := range modelsByPool {
+		decodedPoolID, err := pg.Decode(encodedPoolID)
+		if err != nil {
+			return nil, err
+		}
+		res[pool.PoolIDString(&poolpb.PoolId{Value: decodedPoolID})] = fromPaidBetCountModels(models)
+	}
+	return res, nil
+}
+
+func dbRepairPaidBetCounts(ctx context.Context, pgxPool *pgxpool.Pool, poolID *poolpb.PoolId) (bool, error) {
+	var isRepaired bool
+	err := pg.ExecuteInTx(ctx, pgxPool, func(tx pgx.Tx) error {
+		encodedPoolID := pg.Encode(poolID.Value, pg.Base58)
+
+		// Lock the pool, so counts can't be adjusted while they're being recomputed
+		var lockedPoolID string
+		query := `SELECT "id" FROM ` + poolsTableName + `
+			WHERE "id" = $1
+			FOR UPDATE`
+		err := tx.QueryRow(ctx, query, encodedPoolID).Scan(&lockedPoolID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return pool.ErrPoolNotFound
+		} else if err != nil {
+			return err
+		}
+
+		var bets []*betModel
+		query = `SELECT ` + allBetFields + ` FROM ` + betsTableName + `
+			WHERE "poolId" = $1 AND "isIntentSubmitted" = TRUE`
+		err = pgxscan.Select(ctx, tx, &bets, query, encodedPoolID)
+		if err != nil && !pgxscan.NotFound(err) {
+			return err
+		}
+
+		expected := make([]uint32, pool.NumBooleanOutcomes)
+		for _, model := range bets {
+			bet, err := fromBetModel(model)
+			if err != nil {
+				return err
+			}
+
+			outcome := bet.Outcome()
+			if int(outcome) >= len(expected) {
+				return errors.New("bet outcome out of range")
+			}
+			expected[outcome]++
+		}
+
+		var existing []*paidBetCountModel
+		query = `SELECT ` + allPaidBetCountFields + ` FROM ` + paidBetCountsTableName + `
+			WHERE "poolId" = $1`
+		err = pgxscan.Select(ctx, tx, &existing, query, encodedPoolID)
+		if err != nil && !pgxscan.NotFound(err) {
+			return err
+		}
+
+		actual := fromPaidBetCountModels(existing)
+		isRepaired = len(actual) > len(expected)
+		for i := range expected {
+			if i >= len(actual) || actual[i] != expected[i] {
+				isRepaired = true
+			}
+		}
+		if !isRepaired {
+			return nil
+		}
+
+		query = `DELETE FROM ` + paidBetCountsTableName + ` WHERE "poolId" = $1`
+		_, err = tx.Exec(ctx, query, encodedPoolID)
+		if err != nil {
+			return err
+		}
+
+		query = `INSERT INTO ` + paidBetCountsTableName + `(` + allPaidBetCountFields + `)
+			VALUES ($1, $2, $3, NOW(), NOW())`
+		for outcome, count := range expected {
+			_, err = tx.Exec(ctx, query, encodedPoolID, int64(outcome), int64(count))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return isRepaired, err
+}
+
+// dbAdjustPaidBetCount updates the paid bet count for the bet's outcome, if the
+// bet currently counts towards it. Bets for unknown pools are ignored.
+func dbAdjustPaidBetCount(ctx context.Context, tx pgx.Tx, m *betModel, delta int) error {
+	if !m.IsIntentSubmitted {
+		return nil
+	}
+
+	// Shared lock on the pool, so counts can't be adjusted while they're being repaired
+	var lockedPoolID string
+	query := `SELECT "id" FROM ` + poolsTableName + `
+		WHERE "id" = $1
+		FOR SHARE`
+	err := tx.QueryRow(ctx, query, m.PoolID).Scan(&lockedPoolID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	bet, err := fromBetModel(m)
+	if err != nil {
+		return err
+	}
+	outcome := bet.Outcome()
+
+	query = `INSERT INTO ` + paidBetCountsTableName + `(` + allPaidBetCountFields + `)
+		VALUES ($1, $2, GREATEST($3, 0), NOW(), NOW())
+		ON CONFLICT ("poolId", "outcome") DO UPDATE
+		SET "numPaidBets" = GREATEST(` + paidBetCountsTableName + `."numPaidBets" + $3, 0), "updatedAt" = NOW()`
+	_, err = tx.Exec(
+		ctx,
+		query,
+		m.PoolID,
+		int64(outcome),
+		int64(delta),
+	)
+	return err
+}
+
+func dbGetUnresolvedPools(ctx context.Context, pgxPool *pgxpool.Pool, cursor *poolpb.PoolId, limit int) ([]*poolModel, error) {
+	var encodedCursor string
+	if cursor != nil {
+		encodedCursor = pg.Encode(cursor.Value, pg.Base58)
+	}
+
+	var res []*poolModel
+	query := `SELECT ` + allPoolFields + ` FROM ` + poolsTableName + `
+		WHERE "resolution" = $1 AND "id" > $2
+		ORDER BY "id" ASC
+		LIMIT $3`
+	err := pgxscan.Select(
+		ctx,
+		pgxPool,
+		&res,
+		query,
+		pool.ResolutionUnknown,
+		encodedCursor,
+		limit,
+	)
+	if err != nil {
+		if pgxscan.NotFound(err) {
+			return nil, pool.ErrPoolNotFound
+		}
+		return nil, err
+	}
+	if len(res) == 0 {
+		return nil, pool.ErrPoolNotFound
+	}
+	return res, nil
+}
+
+func dbGetBetsByUserAndPools(ctx context.Context, pgxPool *pgxpool.Pool, userID *commonpb.UserId, poolIDs []*poolpb.PoolId) ([]*betModel, error) {
+	var res []*betModel
+	query := `SELECT ` + allBetFields + ` FROM ` + betsTableName +
+		` WHERE "userId" = $1 AND "poolId" = ANY($2)`
+	err := pgxscan.Select(
+		ctx,
+		pgxPool,
+		&res,
+		query,
+		pg.Encode(userID.Value),
+		encodePoolIDs(poolIDs),
+	)
+	if err != nil {
+		if pgxscan.NotFound(err) {
+			return nil, pool.ErrBetNotFound
+		}
+		return nil, err
+	}
+	if len(res) == 0 {
+		return nil, pool.ErrBetNotFound
+	}
+	return res, nil
+}
+
 func dbGetMember(ctx context.Context, pgxPool *pgxpool.Pool, poolID *poolpb.PoolId, userID *commonpb.UserId) (*memberModel, error) {
 	res := &memberModel{}
 	query := `SELECT ` + allMemberFields + ` FROM ` + membersTableName +
@@ -582,3 +987,11 @@ func dbGetPagedMembers(ctx context.Context, pgxPool *pgxpool.Pool, userID *commo
 	}
 	return res, nil
 }
+
+func encodePoolIDs(poolIDs []*poolpb.PoolId) []string {
+	res := make([]string, len(poolIDs))
+	for i, poolID := range poolIDs {
+		res[i] = pg.Encode(poolID.Value, pg.Base58)
+	}
+	return res
+}
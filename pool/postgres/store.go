@@ -40,6 +40,10 @@ func (s *store) ResolvePool(ctx context.Context, poolID *poolpb.PoolId, resoluti
 	return dbResolvePool(ctx, s.pgxPool, poolID, resolution, newSignature)
 }
 
+func (s *store) MarkRefundOwed(ctx context.Context, poolID *poolpb.PoolId) error {
+	return dbMarkRefundOwed(ctx, s.pgxPool, poolID)
+}
+
 func (s *store) GetPoolByID(ctx context.Context, poolID *poolpb.PoolId) (*pool.Pool, error) {
 	model, err := dbGetPoolByID(ctx, s.pgxPool, poolID)
 	if err != nil {
@@ -48,6 +52,22 @@ func (s *store) GetPoolByID(ctx context.Context, poolID *poolpb.PoolId) (*pool.P
 	return fromPoolModel(model)
 }
 
+func (s *store) GetPoolsByID(ctx context.Context, poolIDs []*poolpb.PoolId) ([]*pool.Pool, error) {
+	models, err := dbGetPoolsByID(ctx, s.pgxPool, poolIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*pool.Pool, len(models))
+	for i, model := range models {
+		res[i], err = fromPoolModel(model)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
 func (s *store) GetPoolByFundingDestination(ctx context.Context, fundingDestination *commonpb.PublicKey) (*pool.Pool, error) {
 	model, err := dbGetPoolByFundingDestination(ctx, s.pgxPool, fundingDestination)
 	if err != nil {
@@ -56,6 +76,38 @@ func (s *store) GetPoolByFundingDestination(ctx context.Context, fundingDestinat
 	return fromPoolModel(model)
 }
 
+func (s *store) GetUnresolvedPoolsClosedBefore(ctx context.Context, cutoff time.Time, limit int) ([]*pool.Pool, error) {
+	models, err := dbGetUnresolvedPoolsClosedBefore(ctx, s.pgxPool, cutoff, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*pool.Pool, len(models))
+	for i, model := range models {
+		res[i], err = fromPoolModel(model)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+func (s *store) GetUnresolvedPools(ctx context.Context, cursor *poolpb.PoolId, limit int) ([]*pool.Pool, error) {
+	models, err := dbGetUnresolvedPools(ctx, s.pgxPool, cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*pool.Pool, len(models))
+	for i, model := range models {
+		res[i], err = fromPoolModel(model)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
 func (s *store) CreateBet(ctx context.Context, bet *pool.Bet) error {
 	err := toBetModel(bet).dbPut(ctx, s.pgxPool)
 	if err != nil {
@@ -129,6 +181,50 @@ func (s *store) GetPagedMembers(ctx context.Context, userID *commonpb.UserId, qu
 	return res, nil
 }
 
+func (s *store) GetBetsByUserAndPools(ctx context.Context, userID *commonpb.UserId, poolIDs []*poolpb.PoolId) ([]*pool.Bet, error) {
+	models, err := dbGetBetsByUserAndPools(ctx, s.pgxPool, userID, poolIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*pool.Bet, len(models))
+	for i, model := range models {
+		res[i], err = fromBetModel(model)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+func (s *store) ClaimUnpaidBetsOnUnresolvedPools(ctx context.Context, leaseDuration time.Duration, limit int) ([]*pool.Bet, error) {
+	models, err := dbClaimUnpaidBetsOnUnresolvedPools(ctx, s.pgxPool, leaseDuration, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*pool.Bet, len(models))
+	for i, model := range models {
+		res[i], err = fromBetModel(model)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+func (s *store) GetPaidBetCounts(ctx context.Context, poolID *poolpb.PoolId) ([]uint32, error) {
+	return dbGetPaidBetCounts(ctx, s.pgxPool, poolID)
+}
+
+func (s *store) GetPaidBetCountsByPools(ctx context.Context, poolIDs []*poolpb.PoolId) (map[string][]uint32, error) {
+	return dbGetPaidBetCountsByPools(ctx, s.pgxPool, poolIDs)
+}
+
+func (s *store) RepairPaidBetCounts(ctx context.Context, poolID *poolpb.PoolId) (bool, error) {
+	return dbRepairPaidBetCounts(ctx, s.pgxPool, poolID)
+}
+
 func (s *store) reset() {
 	_, err := s.pgxPool.Exec(context.Background(), "DELETE FROM "+poolsTableName)
 	if err != nil {
@@ -139,4 +235,9 @@ func (s *store) reset() {
 	if err != nil {
 		panic(err)
 	}
+
+	_, err = s.pgxPool.Exec(context.Background(), "DELETE FROM "+paidBetCountsTableName)
+	if err != nil {
+		panic(err)
+	}
 }
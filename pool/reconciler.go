@@ -0,0 +1,199 @@
+package pool
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	codedata "github.com/code-payments/code-server/pkg/code/data"
+	"github.com/code-payments/flipcash-server/event"
+	"github.com/code-payments/flipcash-server/model"
+)
+
+const (
+	reconcilerBatchSize = 100
+
+	// Bets claimed by a reconciler aren't checked by any other until the lease
+	// expires, which also spaces out the checks for each unpaid bet
+	reconcilerLeaseDuration = time.Minute
+
+	// Bets missing a payment are reported at most once in this interval
+	missingPaymentReportInterval = time.Hour
+
+	// Bets on closed pools are only reported as missing a payment after this
+	// period, giving in-flight payments time to land
+	missingPaymentGracePeriod = 10 * time.Minute
+)
+
+// BetPaymentReconciler is a background worker that checks every unpaid bet on
+// unresolved pools against code-server intents. Newly confirmed payments are
+// marked as paid and members are notified of the updated bet summary. Bets on
+// closed pools whose payment never arrived are reported.
+//
+// It's safe to run on multiple servers, since each server only checks the bets
+// it claims, and only the server that successfully marks a bet as paid notifies
+// members.
+type BetPaymentReconciler struct {
+	log *zap.Logger
+
+	pools Store
+
+	codeData codedata.Provider
+
+	eventForwarder event.Forwarder
+
+	// When bets were last reported as missing a payment by this server
+	reportedBets map[string]time.Time
+}
+
+func NewBetPaymentReconciler(
+	log *zap.Logger,
+	pools Store,
+	codeData codedata.Provider,
+	eventForwarder event.Forwarder,
+) *BetPaymentReconciler {
+	return &BetPaymentReconciler{
+		log: log,
+
+		pools: pools,
+
+		codeData: codeData,
+
+		eventForwarder: eventForwarder,
+
+		reportedBets: make(map[string]time.Time),
+	}
+}
+
+// Start runs the reconciler until the provided context is cancelled
+func (r *BetPaymentReconciler) Start(ctx context.Context, interval time.Duration) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+
+		err := r.reconcileUnpaidBets(ctx)
+		if err != nil {
+			r.log.With(zap.Error(err)).Warn("Failure reconciling bet payments")
+		}
+	}
+}
+
+func (r *BetPaymentReconciler) reconcileUnpaidBets(ctx context.Context) error {
+	poolsByID := make(map[string]*Pool)
+	poolsToNotify := make(map[string]*Pool)
+
+	// Claimed bets are skipped by later claims, so claiming continues until
+	// there's nothing left to claim
+	for {
+		bets, err := r.pools.ClaimUnpaidBetsOnUnresolvedPools(ctx, reconcilerLeaseDuration, reconcilerBatchSize)
+		if err == ErrBetNotFound {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		for _, bet := range bets {
+			key := PoolIDString(bet.PoolID)
+
+			pool, ok := poolsByID[key]
+			if !ok {
+				pool, err = r.pools.GetPoolByID(ctx, bet.PoolID)
+				if err != nil {
+					return err
+				}
+				poolsByID[key] = pool
+			}
+
+			isPaid, isMarked, err := r.reconcileBet(ctx, pool, bet)
+			if err != nil {
+				return err
+			}
+
+			if isMarked {
+				poolsToNotify[key] = pool
+			}
+			if !isPaid && !pool.IsOpen && pool.ClosedAt != nil && time.Since(*pool.ClosedAt) > missingPaymentGracePeriod {
+				r.reportMissingPayment(pool, bet)
+			}
+		}
+
+		if len(bets) < reconcilerBatchSize {
+			break
+		}
+	}
+
+	// Forget reports old enough to be repeated, which also drops bets that have
+	// since been paid or resolved
+	for key, reportedAt := range r.reportedBets {
+		if time.Since(reportedAt) > missingPaymentReportInterval {
+			delete(r.reportedBets, key)
+		}
+	}
+
+	ts := time.Now()
+	for _, pool := range poolsToNotify {
+		err := notifyPoolBetUpdate(ctx, r.pools, r.eventForwarder, pool, ts)
+		if err != nil {
+			r.log.With(
+				zap.Error(err),
+				zap.String("pool_id", PoolIDString(pool.ID)),
+			).Warn("Failed to notify reconciled bet payments")
+		}
+	}
+
+	return nil
+}
+
+// reconcileBet marks the bet as paid if its payment intent exists. It returns
+// whether the bet is paid, and whether this server was the one to mark it.
+func (r *BetPaymentReconciler) reconcileBet(ctx context.Context, pool *Pool, bet *Bet) (bool, bool, error) {
+	log := r.log.With(
+		zap.String("pool_id", PoolIDString(pool.ID)),
+		zap.String("bet_id", BetIDString(bet.ID)),
+	)
+
+	hasPaymentIntent, err := bet.hasPaymentIntent(ctx, r.codeData, pool)
+	if err != nil {
+		log.With(zap.Error(err)).Warn("Failure checking bet payment intent")
+		return false, false, err
+	} else if !hasPaymentIntent {
+		return false, false, nil
+	}
+
+	err = r.pools.MarkBetAsPaid(ctx, bet.ID)
+	switch err {
+	case nil:
+	case ErrBetPaid:
+		// Another server, or the payment callback, got here first
+		return true, false, nil
+	case ErrBetNotFound:
+		// Bet no longer exists
+		return false, false, nil
+	default:
+		log.With(zap.Error(err)).Warn("Failure marking bet as paid")
+		return false, false, err
+	}
+
+	log.Debug("Reconciled bet payment")
+
+	return true, true, nil
+}
+
+func (r *BetPaymentReconciler) reportMissingPayment(pool *Pool, bet *Bet) {
+	key := BetIDString(bet.ID)
+	if _, ok := r.reportedBets[key]; ok {
+		return
+	}
+	r.reportedBets[key] = time.Now()
+
+	r.log.With(
+		zap.String("pool_id", PoolIDString(pool.ID)),
+		zap.String("bet_id", key),
+		zap.String("user_id", model.UserIDString(bet.UserID)),
+		zap.Time("closed_at", *pool.ClosedAt),
+	).Warn("Bet payment never arrived after pool closed")
+}
@@ -0,0 +1,131 @@
+package pool
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	coderetry "github.com/code-payments/code-server/pkg/retry"
+	codebackoff "github.com/code-payments/code-server/pkg/retry/backoff"
+	"github.com/code-payments/flipcash-server/push"
+)
+
+const (
+	DefaultResolutionDeadline = 7 * 24 * time.Hour
+
+	refunderBatchSize = 100
+
+	refunderPushRetryLimit = 5
+)
+
+// Refunder is a background worker that marks closed pools as owing refunds when
+// the creator hasn't resolved them within the resolution deadline, and asks the
+// creator to refund bettors. The pool remains unresolved until the creator signs
+// the refund, so its signature always reflects the last client-signed state.
+type Refunder struct {
+	log *zap.Logger
+
+	pools Store
+
+	pusher push.Pusher
+
+	resolutionDeadline time.Duration
+}
+
+func NewRefunder(
+	log *zap.Logger,
+	pools Store,
+	pusher push.Pusher,
+	resolutionDeadline time.Duration,
+) *Refunder {
+	return &Refunder{
+		log: log,
+
+		pools: pools,
+
+		pusher: pusher,
+
+		resolutionDeadline: resolutionDeadline,
+	}
+}
+
+// Start runs the refunder until the provided context is cancelled
+func (r *Refunder) Start(ctx context.Context, interval time.Duration) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+
+		err := r.refundPoolsPastDeadline(ctx)
+		if err != nil {
+			r.log.With(zap.Error(err)).Warn("Failure refunding pools past their resolution deadline")
+		}
+	}
+}
+
+func (r *Refunder) refundPoolsPastDeadline(ctx context.Context) error {
+	for {
+		pools, err := r.pools.GetUnresolvedPoolsClosedBefore(ctx, time.Now().Add(-r.resolutionDeadline), refunderBatchSize)
+		if err == ErrPoolNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		for _, pool := range pools {
+			err = r.refundPool(ctx, pool)
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(pools) < refunderBatchSize {
+			return nil
+		}
+	}
+}
+
+func (r *Refunder) refundPool(ctx context.Context, pool *Pool) error {
+	log := r.log.With(zap.String("pool_id", PoolIDString(pool.ID)))
+
+	betSummary, err := GetBetSummary(ctx, r.pools, pool)
+	if err != nil {
+		log.With(zap.Error(err)).Warn("Failure getting bet summary")
+		return err
+	}
+
+	err = r.pools.MarkRefundOwed(ctx, pool.ID)
+	switch err {
+	case nil:
+	case ErrPoolResolved, ErrPoolRefundOwed:
+		// Resolved by the creator, or another server got here first
+		return nil
+	default:
+		log.With(zap.Error(err)).Warn("Failure marking pool refund as owed")
+		return err
+	}
+
+	log.Debug("Marked pool refund as owed past its resolution deadline")
+
+	if betSummary.NumBets() == 0 {
+		return nil
+	}
+
+	// The pool is no longer picked up once its refund is owed, so the push is
+	// retried rather than left to the next run
+	_, err = coderetry.Retry(
+		func() error {
+			return push.SendRefundOwedBettingPoolPush(ctx, r.pusher, pool.Name, pool.CreatorID)
+		},
+		coderetry.Limit(refunderPushRetryLimit),
+		coderetry.Backoff(codebackoff.BinaryExponential(100*time.Millisecond), time.Second),
+	)
+	if err != nil {
+		log.With(zap.Error(err)).Warn("Failed to send refund owed push")
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package pool
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	poolpb "github.com/code-payments/flipcash-protobuf-api/generated/go/pool/v1"
+)
+
+const (
+	repairerBatchSize = 100
+)
+
+// BetSummaryRepairer is a background worker that recomputes the paid bet counts
+// of unresolved pools from their bets, correcting any drift in the incrementally
+// maintained counters. Resolved pools are skipped, since their counts no longer
+// change.
+type BetSummaryRepairer struct {
+	log *zap.Logger
+
+	pools Store
+}
+
+func NewBetSummaryRepairer(log *zap.Logger, pools Store) *BetSummaryRepairer {
+	return &BetSummaryRepairer{
+		log: log,
+
+		pools: pools,
+	}
+}
+
+// Start runs the repairer until the provided context is cancelled
+func (r *BetSummaryRepairer) Start(ctx context.Context, interval time.Duration) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+
+		err := r.repairUnresolvedPools(ctx)
+		if err != nil {
+			r.log.With(zap.Error(err)).Warn("Failure repairing bet summaries")
+		}
+	}
+}
+
+func (r *BetSummaryRepairer) repairUnresolvedPools(ctx context.Context) error {
+	var cursor *poolpb.PoolId
+	for {
+		pools, err := r.pools.GetUnresolvedPools(ctx, cursor, repairerBatchSize)
+		if err == ErrPoolNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		for _, pool := range pools {
+			err = r.repairPool(ctx, pool)
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(pools) < repairerBatchSize {
+			return nil
+		}
+		cursor = pools[len(pools)-1].ID
+	}
+}
+
+func (r *BetSummaryRepairer) repairPool(ctx context.Context, pool *Pool) error {
+	log := r.log.With(zap.String("pool_id", PoolIDString(pool.ID)))
+
+	isRepaired, err := r.pools.RepairPaidBetCounts(ctx, pool.ID)
+	if err != nil {
+		log.With(zap.Error(err)).Warn("Failure repairing paid bet counts")
+		return err
+	}
+
+	if isRepaired {
+		log.Info("Repaired drifted paid bet counts")
+	}
+	return nil
+}
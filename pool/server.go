@@ -11,7 +11,6 @@ import (
 
 	codecommonpb "github.com/code-payments/code-protobuf-api/generated/go/common/v1"
 	commonpb "github.com/code-payments/flipcash-protobuf-api/generated/go/common/v1"
-	eventpb "github.com/code-payments/flipcash-protobuf-api/generated/go/event/v1"
 	poolpb "github.com/code-payments/flipcash-protobuf-api/generated/go/pool/v1"
 
 	codecommon "github.com/code-payments/code-server/pkg/code/common"
@@ -43,7 +42,9 @@ type Server struct {
 
 	codeData codedata.Provider
 
-	eventBus *event.Bus[*commonpb.UserId, *eventpb.Event]
+	buyInPolicy *BuyInPolicy
+
+	eventForwarder event.Forwarder
 
 	pusher push.Pusher
 
@@ -57,7 +58,8 @@ func NewServer(
 	pools Store,
 	profiles profile.Store,
 	codeData codedata.Provider,
-	eventBus *event.Bus[*commonpb.UserId, *eventpb.Event],
+	buyInPolicy *BuyInPolicy,
+	eventForwarder event.Forwarder,
 	pusher push.Pusher,
 ) *Server {
 	return &Server{
@@ -71,13 +73,14 @@ func NewServer(
 
 		codeData: codeData,
 
-		eventBus: eventBus,
+		buyInPolicy: buyInPolicy,
+
+		eventForwarder: eventForwarder,
 
 		pusher: pusher,
 	}
 }
 
-// todo: Add buy in amount validation (min/max)
 func (s *Server) CreatePool(ctx context.Context, req *poolpb.CreatePoolRequest) (*poolpb.CreatePoolResponse, error) {
 	userID, err := s.authz.Authorize(ctx, req, &req.Auth)
 	if err != nil {
@@ -124,6 +127,15 @@ func (s *Server) CreatePool(ctx context.Context, req *poolpb.CreatePoolRequest)
 		return nil, status.Error(codes.InvalidArgument, reason)
 	}
 
+	isAllowed, reason, err := s.buyInPolicy.AllowBuyIn(ctx, userID, req.Pool.BuyIn)
+	if err != nil {
+		log.With(zap.Error(err)).Warn("Failure evaluating buy in policy")
+		return nil, status.Error(codes.Internal, "failure evaluating buy in policy")
+	} else if !isAllowed {
+		log.With(zap.String("reason", reason)).Debug("Buy in denied by policy")
+		return &poolpb.CreatePoolResponse{Result: poolpb.CreatePoolResponse_DENIED}, nil
+	}
+
 	model := ToPoolModel(req.Pool, req.RendezvousSignature)
 
 	err = database.ExecuteTxWithinCtx(ctx, func(ctx context.Context) error {
@@ -248,16 +260,10 @@ func (s *Server) GetPagedPools(ctx context.Context, req *poolpb.GetPagedPoolsReq
 		return &poolpb.GetPagedPoolsResponse{Result: poolpb.GetPagedPoolsResponse_NOT_FOUND}, nil
 	}
 
-	protoPools := make([]*poolpb.PoolMetadata, len(memberships))
-	for i, membership := range memberships {
-		log := log.With(zap.String("pool_id", PoolIDString(membership.PoolID)))
-
-		protoPool, err := s.getProtoPool(ctx, membership.PoolID, userID, false, false)
-		if err != nil {
-			log.With(zap.Error(err)).Warn("Failure getting pool")
-			return nil, status.Error(codes.Internal, "failure getting pool")
-		}
-		protoPools[i] = protoPool
+	protoPools, err := s.getProtoPoolsForMemberships(ctx, userID, memberships)
+	if err != nil {
+		log.With(zap.Error(err)).Warn("Failure getting pools")
+		return nil, status.Error(codes.Internal, "failure getting pools")
 	}
 	return &poolpb.GetPagedPoolsResponse{Pools: protoPools}, nil
 }
@@ -371,6 +377,10 @@ func (s *Server) ResolvePool(ctx context.Context, req *poolpb.ResolvePoolRequest
 		}
 		return &poolpb.ResolvePoolResponse{}, nil
 	}
+	if pool.IsRefundOwed && resolution != ResolutionRefunded {
+		// The resolution deadline has passed, so bettors are owed a refund
+		return &poolpb.ResolvePoolResponse{Result: poolpb.ResolvePoolResponse_DENIED}, nil
+	}
 
 	verifiedProtoPool := pool.ToProto().VerifiedMetadata
 	verifiedProtoPool.Resolution = req.Resolution
@@ -388,7 +398,7 @@ func (s *Server) ResolvePool(ctx context.Context, req *poolpb.ResolvePoolRequest
 	}
 
 	go func() {
-		err = s.notifyPoolResolution(context.Background(), pool.ID, ts)
+		err = notifyPoolResolution(context.Background(), s.pools, s.eventForwarder, s.pusher, pool.ID, ts)
 		if err != nil {
 			log.With(zap.Error(err)).Warn("Failed to notify pool resolution")
 		}
@@ -550,13 +560,18 @@ func (s *Server) getProtoPool(
 		}
 	}
 
-	betSummary, bets, err := GetBetSummary(ctx, s.pools, s.codeData, pool)
+	betSummary, err := GetBetSummary(ctx, s.pools, pool)
 	if err != nil {
 		return nil, err
 	}
 
-	protoPool.BetSummary = betSummary
+	protoPool.BetSummary = betSummary.ToProto()
 	if includeBets {
+		bets, err := s.pools.GetBetsByPool(ctx, pool.ID)
+		if err != nil && err != ErrBetNotFound {
+			return nil, err
+		}
+
 		protoPool.Bets = make([]*poolpb.BetMetadata, len(bets))
 		for i, bet := range bets {
 			protoPool.Bets[i] = bet.ToProto()
@@ -572,33 +587,160 @@ func (s *Server) getProtoPool(
 	}
 
 	if requestingUser != nil {
-		userSummary, err := getUserSummaryWithCachedBetMetadata(requestingUser, pool, betSummary, bets)
-		if err != nil {
+		userBet, err := s.pools.GetBetByUser(ctx, pool.ID, requestingUser)
+		if err == ErrBetNotFound {
+			userBet = nil
+		} else if err != nil {
 			return nil, err
 		}
-		protoPool.UserSummary = userSummary
 
 		membership, err := s.pools.GetMember(ctx, pool.ID, requestingUser)
-		if err == nil {
-			protoPool.PagingToken = &commonpb.PagingToken{Value: membership.ID}
-		} else if err != ErrMemberNotFound {
+		if err == ErrMemberNotFound {
+			membership = nil
+		} else if err != nil {
 			return nil, err
 		}
 
-		// todo: Can we deprecate this?
-		if bytes.Equal(requestingUser.Value, protoPool.VerifiedMetadata.Creator.Value) {
-			fundingDestinationAccount, err := codecommon.NewAccountFromPublicKeyBytes(pool.FundingDestination.Value)
-			if err != nil {
-				return nil, err
-			}
+		derivationIndexes, err := s.getCreatorDerivationIndexes(ctx, requestingUser, pool)
+		if err != nil {
+			return nil, err
+		}
 
-			accountInfoRecord, err := s.codeData.GetAccountInfoByTokenAddress(ctx, fundingDestinationAccount.PublicKey().ToBase58())
-			if err != nil {
-				return nil, err
-			}
-			protoPool.DerivationIndex = accountInfoRecord.Index
+		err = setRequestingUserMetadata(protoPool, pool, betSummary, userBet, membership, derivationIndexes)
+		if err != nil {
+			return nil, err
 		}
 	}
 
 	return protoPool, nil
 }
+
+// getProtoPoolsForMemberships is the batched equivalent of calling getProtoPool
+// for each of the user's memberships without bets or user profiles. Pools are
+// returned in the same order as the memberships.
+func (s *Server) getProtoPoolsForMemberships(ctx context.Context, userID *commonpb.UserId, memberships []*Member) ([]*poolpb.PoolMetadata, error) {
+	poolIDs := make([]*poolpb.PoolId, len(memberships))
+	for i, membership := range memberships {
+		poolIDs[i] = membership.PoolID
+	}
+
+	pools, err := s.pools.GetPoolsByID(ctx, poolIDs)
+	if err != nil {
+		return nil, err
+	}
+	poolsByID := make(map[string]*Pool)
+	for _, pool := range pools {
+		poolsByID[PoolIDString(pool.ID)] = pool
+	}
+
+	paidBetCountsByPool, err := s.pools.GetPaidBetCountsByPools(ctx, poolIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	userBets, err := s.pools.GetBetsByUserAndPools(ctx, userID, poolIDs)
+	if err != nil && err != ErrBetNotFound {
+		return nil, err
+	}
+	userBetsByPool := make(map[string]*Bet)
+	for _, bet := range userBets {
+		userBetsByPool[PoolIDString(bet.PoolID)] = bet
+	}
+
+	derivationIndexes, err := s.getCreatorDerivationIndexes(ctx, userID, pools...)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*poolpb.PoolMetadata, len(memberships))
+	for i, membership := range memberships {
+		key := PoolIDString(membership.PoolID)
+
+		pool, ok := poolsByID[key]
+		if !ok {
+			return nil, ErrPoolNotFound
+		}
+
+		protoPool := pool.ToProto()
+		protoPool.IsFundingDestinationInitialized = true
+
+		betSummary, err := newBetSummary(pool, paidBetCountsByPool[key])
+		if err != nil {
+			return nil, err
+		}
+		protoPool.BetSummary = betSummary.ToProto()
+
+		err = setRequestingUserMetadata(protoPool, pool, betSummary, userBetsByPool[key], membership, derivationIndexes)
+		if err != nil {
+			return nil, err
+		}
+
+		res[i] = protoPool
+	}
+	return res, nil
+}
+
+// setRequestingUserMetadata sets the pool metadata that's specific to the
+// requesting user. The user's bet and membership are nil when they don't exist.
+// Derivation indexes are keyed by pool ID, for the pools the user created.
+func setRequestingUserMetadata(
+	protoPool *poolpb.PoolMetadata,
+	pool *Pool,
+	betSummary *BetSummary,
+	userBet *Bet,
+	membership *Member,
+	derivationIndexes map[string]uint64,
+) error {
+	userSummary, err := getUserSummaryForBet(pool, betSummary, userBet)
+	if err != nil {
+		return err
+	}
+	protoPool.UserSummary = userSummary
+
+	if membership != nil {
+		protoPool.PagingToken = &commonpb.PagingToken{Value: membership.ID}
+	}
+
+	// todo: Can we deprecate this?
+	if derivationIndex, ok := derivationIndexes[PoolIDString(pool.ID)]; ok {
+		protoPool.DerivationIndex = derivationIndex
+	}
+
+	return nil
+}
+
+// getCreatorDerivationIndexes gets the derivation indexes of the funding
+// destinations for the pools created by the user, keyed by pool ID, in a
+// single batch
+func (s *Server) getCreatorDerivationIndexes(ctx context.Context, userID *commonpb.UserId, pools ...*Pool) (map[string]uint64, error) {
+	poolIDsByAddress := make(map[string]string)
+	var addresses []string
+	for _, pool := range pools {
+		if !bytes.Equal(userID.Value, pool.CreatorID.Value) {
+			continue
+		}
+
+		fundingDestinationAccount, err := codecommon.NewAccountFromPublicKeyBytes(pool.FundingDestination.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		address := fundingDestinationAccount.PublicKey().ToBase58()
+		poolIDsByAddress[address] = PoolIDString(pool.ID)
+		addresses = append(addresses, address)
+	}
+
+	res := make(map[string]uint64)
+	if len(addresses) == 0 {
+		return res, nil
+	}
+
+	accountInfoRecords, err := s.codeData.GetAccountInfoByTokenAddressBatch(ctx, addresses...)
+	if err != nil {
+		return nil, err
+	}
+	for address, accountInfoRecord := range accountInfoRecords {
+		res[poolIDsByAddress[address]] = accountInfoRecord.Index
+	}
+	return res, nil
+}
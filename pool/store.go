@@ -16,9 +16,11 @@ var (
 	ErrPoolFundingDestinationExists = errors.New("pool funding address already exists")
 	ErrPoolOpen                     = errors.New("pool is open")
 	ErrPoolResolved                 = errors.New("pool is already resolved")
+	ErrPoolRefundOwed               = errors.New("pool refund is already owed")
 	ErrBetNotFound                  = errors.New("bet not found")
 	ErrBetExists                    = errors.New("bet already exists")
 	ErrMaxBetCountExceeded          = errors.New("max bet count exceeded")
+	ErrBetPaid                      = errors.New("bet is already paid")
 	ErrMemberNotFound               = errors.New("pool member not found")
 )
 
@@ -32,19 +34,37 @@ type Store interface {
 	// ResolvePool resolves a pool with an outcome
 	ResolvePool(ctx context.Context, poolID *poolpb.PoolId, resolution Resolution, newSignature *commonpb.Signature) error
 
+	// MarkRefundOwed marks a closed pool as owing refunds after its resolution
+	// deadline has passed. The pool remains unresolved until the creator signs
+	// the refund. ErrPoolRefundOwed is returned if the pool was already marked.
+	MarkRefundOwed(ctx context.Context, poolID *poolpb.PoolId) error
+
 	// GetPoolByID gets a betting pool by ID
 	GetPoolByID(ctx context.Context, poolID *poolpb.PoolId) (*Pool, error)
 
+	// GetPoolsByID gets betting pools by their IDs in a single batch. Pools
+	// that don't exist are omitted, and results aren't in any particular order.
+	GetPoolsByID(ctx context.Context, poolIDs []*poolpb.PoolId) ([]*Pool, error)
+
 	// GetPoolByFundingDestination gets a betting pool by the funding destination
 	GetPoolByFundingDestination(ctx context.Context, fundingDestination *commonpb.PublicKey) (*Pool, error)
 
+	// GetUnresolvedPoolsClosedBefore gets closed pools without a resolution that
+	// were closed at or before the provided cutoff, and aren't already owing refunds
+	GetUnresolvedPoolsClosedBefore(ctx context.Context, cutoff time.Time, limit int) ([]*Pool, error)
+
+	// GetUnresolvedPools gets pools without a resolution, ordered by ID, starting
+	// after the provided cursor. A nil cursor starts from the beginning.
+	GetUnresolvedPools(ctx context.Context, cursor *poolpb.PoolId, limit int) ([]*Pool, error)
+
 	// CreateBet creates a new bet
 	CreateBet(ctx context.Context, bet *Bet) error
 
 	// UpdateBetOutcome updates an existing bet's outcome
 	UpdateBetOutcome(ctx context.Context, betId *poolpb.BetId, newOutcome bool, newSignature *commonpb.Signature, newTs time.Time) error
 
-	// MarkBetAsPaid marks a bet as paid
+	// MarkBetAsPaid marks a bet as paid. ErrBetPaid is returned if the bet was
+	// already marked as paid.
 	MarkBetAsPaid(ctx context.Context, betId *poolpb.BetId) error
 
 	// GetBetByID gets a bet by its ID
@@ -56,6 +76,30 @@ type Store interface {
 	// GetBetsByPool gets all bets for a given pool
 	GetBetsByPool(ctx context.Context, poolID *poolpb.PoolId) ([]*Bet, error)
 
+	// GetBetsByUserAndPools gets the bets a user made across a batch of pools.
+	// Results aren't in any particular order.
+	GetBetsByUserAndPools(ctx context.Context, userID *commonpb.UserId, poolIDs []*poolpb.PoolId) ([]*Bet, error)
+
+	// ClaimUnpaidBetsOnUnresolvedPools claims up to limit bets that haven't been
+	// marked as paid on pools without a resolution, until the lease expires. Bets
+	// with an unexpired claim are skipped, so concurrent callers never claim the
+	// same bet. Results aren't in any particular order.
+	ClaimUnpaidBetsOnUnresolvedPools(ctx context.Context, leaseDuration time.Duration, limit int) ([]*Bet, error)
+
+	// GetPaidBetCounts gets the number of paid bets for each outcome of a pool,
+	// indexed by outcome. The counts are updated within the same transaction as
+	// the bet changes that affect them, so they can be read without scanning bets.
+	// Outcomes without a paid bet may be omitted.
+	GetPaidBetCounts(ctx context.Context, poolID *poolpb.PoolId) ([]uint32, error)
+
+	// GetPaidBetCountsByPools is the batched version of GetPaidBetCounts. Results
+	// are keyed by the pool's string ID, and pools without paid bets may be omitted.
+	GetPaidBetCountsByPools(ctx context.Context, poolIDs []*poolpb.PoolId) (map[string][]uint32, error)
+
+	// RepairPaidBetCounts recomputes a pool's paid bet counts from its bets,
+	// returning whether the persisted counts needed to be corrected
+	RepairPaidBetCounts(ctx context.Context, poolID *poolpb.PoolId) (bool, error)
+
 	// GetMember gets the pool memberships for the provided pool and user
 	GetMember(ctx context.Context, poolID *poolpb.PoolId, userID *commonpb.UserId) (*Member, error)
 
@@ -3,6 +3,7 @@ package tests
 import (
 	"bytes"
 	"context"
+	"sync"
 	"testing"
 	"time"
 
@@ -12,15 +13,22 @@ import (
 	"google.golang.org/protobuf/types/known/timestamppb"
 
 	codecommonpb "github.com/code-payments/code-protobuf-api/generated/go/common/v1"
+	codetransactionpb "github.com/code-payments/code-protobuf-api/generated/go/transaction/v2"
 	commonpb "github.com/code-payments/flipcash-protobuf-api/generated/go/common/v1"
 	eventpb "github.com/code-payments/flipcash-protobuf-api/generated/go/event/v1"
 	poolpb "github.com/code-payments/flipcash-protobuf-api/generated/go/pool/v1"
 
 	"github.com/code-payments/code-server/pkg/code/common"
 	codecommon "github.com/code-payments/code-server/pkg/code/common"
+	codecurrencyutil "github.com/code-payments/code-server/pkg/code/currency"
 	codedata "github.com/code-payments/code-server/pkg/code/data"
 	codeaccount "github.com/code-payments/code-server/pkg/code/data/account"
+	codecurrencydata "github.com/code-payments/code-server/pkg/code/data/currency"
+	codedeposit "github.com/code-payments/code-server/pkg/code/data/deposit"
 	codeintent "github.com/code-payments/code-server/pkg/code/data/intent"
+	codetransaction "github.com/code-payments/code-server/pkg/code/data/transaction"
+	codecurrency "github.com/code-payments/code-server/pkg/currency"
+	codetimelock "github.com/code-payments/code-server/pkg/solana/timelock/v1"
 	codetestutil "github.com/code-payments/code-server/pkg/testutil"
 	"github.com/code-payments/flipcash-server/account"
 	"github.com/code-payments/flipcash-server/auth"
@@ -41,8 +49,13 @@ import (
 func RunServerTests(t *testing.T, accounts account.Store, pools pool.Store, profiles profile.Store, teardown func()) {
 	for _, tf := range []func(t *testing.T, accounts account.Store, pools pool.Store, profiles profile.Store){
 		testServer_PoolManagement_HappyPath,
+		testServer_PoolManagement_BuyInPolicy,
+		testServer_PoolManagement_RefundOwed,
 		testServer_Betting_HappyPath,
 		testServer_Membership_HappyPath,
+		testServer_Membership_PagedPoolsMatchGetPool,
+		testServer_Payout_PlanPreconditions,
+		testServer_Payout_DistributionRemainder,
 	} {
 		tf(t, accounts, pools, profiles)
 		teardown()
@@ -51,13 +64,9 @@ func RunServerTests(t *testing.T, accounts account.Store, pools pool.Store, prof
 
 func testServer_PoolManagement_HappyPath(t *testing.T, accounts account.Store, pools pool.Store, profiles profile.Store) {
 	ctx := context.Background()
-	log := zaptest.NewLogger(t)
-
-	authn := auth.NewKeyPairAuthenticator()
-	authz := account.NewAuthorizer(log, accounts, authn)
 	codeData := codedata.NewTestDataProvider()
 	eventBus := event.NewBus[*commonpb.UserId, *eventpb.Event]()
-	server := pool.NewServer(log, authz, accounts, pools, profiles, codeData, eventBus, push.NewNoOpPusher())
+	server := newTestServer(t, accounts, pools, profiles, codeData, eventBus, push.NewNoOpPusher())
 	codetestutil.SetupRandomSubsidizer(t, codeData)
 
 	creatorKey := model.MustGenerateKeyPair()
@@ -140,17 +149,166 @@ func testServer_PoolManagement_HappyPath(t *testing.T, accounts account.Store, p
 	require.EqualValues(t, 0, getResp.Pool.DerivationIndex)
 }
 
-func testServer_Betting_HappyPath(t *testing.T, accounts account.Store, pools pool.Store, profiles profile.Store) {
+func testServer_PoolManagement_BuyInPolicy(t *testing.T, accounts account.Store, pools pool.Store, profiles profile.Store) {
 	ctx := context.Background()
-	log := zaptest.NewLogger(t)
+	codeData := codedata.NewTestDataProvider()
+	eventBus := event.NewBus[*commonpb.UserId, *eventpb.Event]()
+	staffAccounts := &testStaffAccountStore{Store: accounts, staff: make(map[string]struct{})}
+	codetestutil.SetupRandomSubsidizer(t, codeData)
+
+	userLimits := pool.BuyInLimits{MinUsd: 1.00, MaxUsd: 250.00}
+	staffLimits := pool.BuyInLimits{MinUsd: 0.01, MaxUsd: 1000.00}
+	buyInPolicy := pool.NewBuyInPolicy(staffAccounts, codeData, pool.BuyInPolicyConfig{
+		UserLimits:  userLimits,
+		StaffLimits: staffLimits,
+	})
+	server := newTestServerWithBuyInPolicy(t, staffAccounts, pools, profiles, codeData, buyInPolicy, eventBus, push.NewNoOpPusher())
+
+	require.NoError(t, codeData.ImportExchangeRates(ctx, &codecurrencydata.MultiRateRecord{
+		Time:  codecurrencyutil.GetLatestExchangeRateTime(),
+		Rates: map[string]float64{"eur": 0.5},
+	}))
+
+	for _, tc := range []struct {
+		buyIn     *commonpb.FiatPaymentAmount
+		isStaff   bool
+		isAllowed bool
+	}{
+		{buyIn: &commonpb.FiatPaymentAmount{Currency: "usd", NativeAmount: userLimits.MinUsd}, isAllowed: true},
+		{buyIn: &commonpb.FiatPaymentAmount{Currency: "usd", NativeAmount: userLimits.MaxUsd}, isAllowed: true},
+		{buyIn: &commonpb.FiatPaymentAmount{Currency: "usd", NativeAmount: userLimits.MinUsd / 2}},
+		{buyIn: &commonpb.FiatPaymentAmount{Currency: "usd", NativeAmount: userLimits.MaxUsd + 0.01}},
+		{buyIn: &commonpb.FiatPaymentAmount{Currency: "usd", NativeAmount: userLimits.MinUsd / 2}, isStaff: true, isAllowed: true},
+		{buyIn: &commonpb.FiatPaymentAmount{Currency: "usd", NativeAmount: staffLimits.MaxUsd}, isStaff: true, isAllowed: true},
+		{buyIn: &commonpb.FiatPaymentAmount{Currency: "usd", NativeAmount: staffLimits.MinUsd / 2}, isStaff: true},
+		{buyIn: &commonpb.FiatPaymentAmount{Currency: "usd", NativeAmount: staffLimits.MaxUsd + 0.01}, isStaff: true},
+		{buyIn: &commonpb.FiatPaymentAmount{Currency: "eur", NativeAmount: userLimits.MaxUsd / 2}, isAllowed: true},
+		{buyIn: &commonpb.FiatPaymentAmount{Currency: "eur", NativeAmount: userLimits.MaxUsd/2 + 0.01}},
+		{buyIn: &commonpb.FiatPaymentAmount{Currency: "xyz", NativeAmount: 5.00}},
+		{buyIn: &commonpb.FiatPaymentAmount{Currency: "USD", NativeAmount: 5.00}},
+		{buyIn: &commonpb.FiatPaymentAmount{Currency: "cad", NativeAmount: 5.00}}, // No exchange rate
+	} {
+		creatorKey := model.MustGenerateKeyPair()
+		rendezvousKey := model.MustGenerateKeyPair()
+		poolID := pool.ToPoolID(rendezvousKey)
+		expected := generateNewProtoPool(poolID)
+		expected.BuyIn = tc.buyIn
+		accounts.Bind(ctx, expected.Creator, creatorKey.Proto())
+		accounts.SetRegistrationFlag(ctx, expected.Creator, true)
+		if tc.isStaff {
+			staffAccounts.staff[string(expected.Creator.Value)] = struct{}{}
+		}
+		setupPoolAccountOnCode(t, codeData, creatorKey.Proto(), expected.FundingDestination)
+
+		createReq := &poolpb.CreatePoolRequest{
+			Pool: expected,
+		}
+		require.NoError(t, rendezvousKey.Sign(expected, &createReq.RendezvousSignature))
+		require.NoError(t, creatorKey.Auth(createReq, &createReq.Auth))
+
+		createResp, err := server.CreatePool(ctx, createReq)
+		if tc.isAllowed {
+			require.NoError(t, err)
+			require.Equal(t, poolpb.CreatePoolResponse_OK, createResp.Result)
+		} else {
+			require.NoError(t, err)
+			require.Equal(t, poolpb.CreatePoolResponse_DENIED, createResp.Result)
+		}
 
-	authn := auth.NewKeyPairAuthenticator()
-	authz := account.NewAuthorizer(log, accounts, authn)
+		getResp, err := server.GetPool(ctx, &poolpb.GetPoolRequest{Id: poolID})
+		require.NoError(t, err)
+		if tc.isAllowed {
+			require.Equal(t, poolpb.GetPoolResponse_OK, getResp.Result)
+		} else {
+			require.Equal(t, poolpb.GetPoolResponse_NOT_FOUND, getResp.Result)
+		}
+	}
+
+	// The default policy doesn't restrict buy ins
+	defaultPolicy := pool.NewBuyInPolicy(accounts, codeData, pool.DefaultBuyInPolicyConfig)
+	for _, buyIn := range []*commonpb.FiatPaymentAmount{
+		{Currency: "usd", NativeAmount: staffLimits.MaxUsd + 0.01},
+		{Currency: "usd", NativeAmount: staffLimits.MinUsd / 2},
+		{Currency: "cad", NativeAmount: 5.00},
+	} {
+		isAllowed, _, err := defaultPolicy.AllowBuyIn(ctx, model.MustGenerateUserID(), buyIn)
+		require.NoError(t, err)
+		require.True(t, isAllowed)
+	}
+
+	// Currencies with an exchange rate can still be restricted to an allowlist
+	restrictedPolicy := pool.NewBuyInPolicy(accounts, codeData, pool.BuyInPolicyConfig{
+		AllowedCurrencies: []codecurrency.Code{codecurrency.USD},
+		UserLimits:        userLimits,
+		StaffLimits:       staffLimits,
+	})
+	isAllowed, _, err := restrictedPolicy.AllowBuyIn(ctx, model.MustGenerateUserID(), &commonpb.FiatPaymentAmount{Currency: "usd", NativeAmount: 5.00})
+	require.NoError(t, err)
+	require.True(t, isAllowed)
+	isAllowed, reason, err := restrictedPolicy.AllowBuyIn(ctx, model.MustGenerateUserID(), &commonpb.FiatPaymentAmount{Currency: "eur", NativeAmount: 5.00})
+	require.NoError(t, err)
+	require.False(t, isAllowed)
+	require.NotEmpty(t, reason)
+}
+
+func testServer_PoolManagement_RefundOwed(t *testing.T, accounts account.Store, pools pool.Store, profiles profile.Store) {
+	ctx := context.Background()
+	codeData := codedata.NewTestDataProvider()
+	eventBus := event.NewBus[*commonpb.UserId, *eventpb.Event]()
+	server := newTestServer(t, accounts, pools, profiles, codeData, eventBus, push.NewNoOpPusher())
+
+	creatorKey := model.MustGenerateKeyPair()
+	rendezvousKey := model.MustGenerateKeyPair()
+	poolID := pool.ToPoolID(rendezvousKey)
+	expected := generateNewProtoPool(poolID)
+	accounts.Bind(ctx, expected.Creator, creatorKey.Proto())
+	accounts.SetRegistrationFlag(ctx, expected.Creator, true)
+
+	expected.IsOpen = false
+	expected.ClosedAt = timestamppb.New(time.Now().Add(-pool.DefaultResolutionDeadline).Truncate(time.Second))
+	var signature *commonpb.Signature
+	require.NoError(t, rendezvousKey.Sign(expected, &signature))
+	require.NoError(t, pools.CreatePool(ctx, pool.ToPoolModel(expected, signature)))
+	require.NoError(t, pools.MarkRefundOwed(ctx, poolID))
+
+	// Only a refund can be signed once the resolution deadline has passed
+	for _, resolution := range []*poolpb.Resolution{
+		{Kind: &poolpb.Resolution_BooleanResolution{BooleanResolution: true}},
+		{Kind: &poolpb.Resolution_RefundResolution{RefundResolution: &poolpb.Resolution_Refund{}}},
+	} {
+		expected.Resolution = resolution
+		resolveReq := &poolpb.ResolvePoolRequest{
+			Id:         poolID,
+			Resolution: expected.Resolution,
+		}
+		require.NoError(t, rendezvousKey.Sign(expected, &resolveReq.NewRendezvousSignature))
+		require.NoError(t, creatorKey.Auth(resolveReq, &resolveReq.Auth))
+
+		resolveResp, err := server.ResolvePool(ctx, resolveReq)
+		require.NoError(t, err)
+
+		actual, err := pools.GetPoolByID(ctx, poolID)
+		require.NoError(t, err)
+
+		if pool.ToResolution(resolution) == pool.ResolutionRefunded {
+			require.Equal(t, poolpb.ResolvePoolResponse_OK, resolveResp.Result)
+			require.Equal(t, pool.ResolutionRefunded, actual.Resolution)
+			require.NoError(t, protoutil.ProtoEqualError(resolveReq.NewRendezvousSignature, actual.Signature))
+		} else {
+			require.Equal(t, poolpb.ResolvePoolResponse_DENIED, resolveResp.Result)
+			require.False(t, actual.HasResolution())
+			require.NoError(t, protoutil.ProtoEqualError(signature, actual.Signature))
+		}
+	}
+}
+
+func testServer_Betting_HappyPath(t *testing.T, accounts account.Store, pools pool.Store, profiles profile.Store) {
+	ctx := context.Background()
 	codeData := codedata.NewTestDataProvider()
 	eventBus := event.NewBus[*commonpb.UserId, *eventpb.Event]()
 	eventObserver := event.NewTestEventObserver[*commonpb.UserId, *eventpb.Event]()
 	eventBus.AddHandler(eventObserver)
-	server := pool.NewServer(log, authz, accounts, pools, profiles, codeData, eventBus, push.NewNoOpPusher())
+	server := newTestServer(t, accounts, pools, profiles, codeData, eventBus, push.NewNoOpPusher())
 	codetestutil.SetupRandomSubsidizer(t, codeData)
 
 	creatorKey := model.MustGenerateKeyPair()
@@ -230,7 +388,7 @@ func testServer_Betting_HappyPath(t *testing.T, accounts account.Store, pools po
 	require.EqualValues(t, 0, getPoolResp.Pool.BetSummary.TotalAmountBet.NativeAmount)
 
 	for _, bet := range expectedBets {
-		simulateBetPayment(t, codeData, protoPool, bet)
+		simulateBetPayment(t, codeData, pools, protoPool, bet)
 	}
 
 	getReq = &poolpb.GetPoolRequest{
@@ -336,13 +494,9 @@ func testServer_Betting_HappyPath(t *testing.T, accounts account.Store, pools po
 
 func testServer_Membership_HappyPath(t *testing.T, accounts account.Store, pools pool.Store, profiles profile.Store) {
 	ctx := context.Background()
-	log := zaptest.NewLogger(t)
-
-	authn := auth.NewKeyPairAuthenticator()
-	authz := account.NewAuthorizer(log, accounts, authn)
 	codeData := codedata.NewTestDataProvider()
 	eventBus := event.NewBus[*commonpb.UserId, *eventpb.Event]()
-	server := pool.NewServer(log, authz, accounts, pools, profiles, codeData, eventBus, push.NewNoOpPusher())
+	server := newTestServer(t, accounts, pools, profiles, codeData, eventBus, push.NewNoOpPusher())
 	codetestutil.SetupRandomSubsidizer(t, codeData)
 
 	creatorKey := model.MustGenerateKeyPair()
@@ -415,6 +569,254 @@ func testServer_Membership_HappyPath(t *testing.T, accounts account.Store, pools
 	require.EqualValues(t, 0, getPagedResp.Pools[0].DerivationIndex)
 }
 
+func testServer_Payout_PlanPreconditions(t *testing.T, accounts account.Store, pools pool.Store, profiles profile.Store) {
+	ctx := context.Background()
+	codeData := codedata.NewTestDataProvider()
+
+	rendezvousKey := model.MustGenerateKeyPair()
+	poolID := pool.ToPoolID(rendezvousKey)
+	protoPool := generateNewProtoPool(poolID)
+
+	var signature *commonpb.Signature
+	require.NoError(t, rendezvousKey.Sign(protoPool, &signature))
+	require.NoError(t, pools.CreatePool(ctx, pool.ToPoolModel(protoPool, signature)))
+
+	getPayoutPlan := func() error {
+		bettingPool, err := pools.GetPoolByID(ctx, poolID)
+		require.NoError(t, err)
+
+		_, err = pool.GetPayoutPlan(ctx, pools, codeData, bettingPool)
+		return err
+	}
+
+	require.Equal(t, pool.ErrPoolOpen, getPayoutPlan())
+
+	require.NoError(t, pools.ClosePool(ctx, poolID, time.Now(), signature))
+	require.Equal(t, pool.ErrPoolNotResolved, getPayoutPlan())
+
+	require.NoError(t, pools.ResolvePool(ctx, poolID, pool.ResolutionYes, signature))
+	require.Equal(t, pool.ErrNoBetsToPayout, getPayoutPlan())
+}
+
+func testServer_Payout_DistributionRemainder(t *testing.T, accounts account.Store, pools pool.Store, profiles profile.Store) {
+	ctx := context.Background()
+
+	codeData := codedata.NewTestDataProvider()
+	intentHandler := pool.NewIntentHandler(pools, codeData, nil)
+
+	// 10 quarks can't be evenly split across 3 winning bets
+	fundingDestination := setupFundedPoolVaultOnCode(t, codeData, 10)
+
+	rendezvousKey := model.MustGenerateKeyPair()
+	poolID := pool.ToPoolID(rendezvousKey)
+	protoPool := generateNewProtoPool(poolID)
+	protoPool.FundingDestination = &commonpb.PublicKey{Value: fundingDestination.PublicKey().ToBytes()}
+
+	var signature *commonpb.Signature
+	require.NoError(t, rendezvousKey.Sign(protoPool, &signature))
+	require.NoError(t, pools.CreatePool(ctx, pool.ToPoolModel(protoPool, signature)))
+
+	var winners []*poolpb.SignedBetMetadata
+	for i := range 4 {
+		protoBet := generateNewProtoBet(i < 3)
+		require.NoError(t, pools.CreateBet(ctx, pool.ToBetModel(poolID, protoBet, signature)))
+		simulateBetPayment(t, codeData, pools, protoPool, protoBet)
+
+		if protoBet.SelectedOutcome.GetBooleanOutcome() {
+			winners = append(winners, protoBet)
+		}
+	}
+
+	require.NoError(t, pools.ClosePool(ctx, poolID, time.Now(), signature))
+	require.NoError(t, pools.ResolvePool(ctx, poolID, pool.ResolutionYes, signature))
+
+	intentRecord := &codeintent.Record{
+		IntentType: codeintent.PublicDistribution,
+		PublicDistributionMetadata: &codeintent.PublicDistributionMetadata{
+			Source: fundingDestination.PublicKey().ToBase58(),
+		},
+	}
+
+	// The payout plan spreads the remainder, and is a valid distribution
+	bettingPool, err := pools.GetPoolByID(ctx, poolID)
+	require.NoError(t, err)
+	plan, err := pool.GetPayoutPlan(ctx, pools, codeData, bettingPool)
+	require.NoError(t, err)
+	require.Len(t, plan.Payouts, len(winners))
+
+	var planActions []*codetransactionpb.Action
+	var plannedQuarks uint64
+	for _, payout := range plan.Payouts {
+		require.Equal(t, pool.PayoutKindWinnings, payout.Kind)
+		require.Contains(t, []uint64{3, 4}, payout.Quarks)
+		planActions = append(planActions, newTestDistributionAction(fundingDestination, payout.Destination, payout.Quarks))
+		plannedQuarks += payout.Quarks
+	}
+	require.EqualValues(t, 10, plannedQuarks)
+	require.NoError(t, intentHandler.ValidateDistribution(ctx, intentRecord, planActions))
+
+	// Clients may spread the remainder differently than the payout plan
+	for _, tc := range []struct {
+		winners []int
+		quarks  []uint64
+		isValid bool
+	}{
+		{winners: []int{0, 1, 2}, quarks: []uint64{4, 3, 3}, isValid: true},
+		{winners: []int{0, 1, 2}, quarks: []uint64{3, 3, 4}, isValid: true},
+		{winners: []int{0, 1, 2}, quarks: []uint64{3, 3, 3}, isValid: false}, // Remainder isn't distributed
+		{winners: []int{0, 1, 2}, quarks: []uint64{2, 4, 4}, isValid: false}, // Below the minimum payout
+		{winners: []int{0, 1}, quarks: []uint64{5, 5}, isValid: false},       // Missing a winning bet
+		{winners: []int{0, 0, 1}, quarks: []uint64{4, 3, 3}, isValid: false}, // Duplicate payout destination
+	} {
+		var actions []*codetransactionpb.Action
+		for i, winner := range tc.winners {
+			actions = append(actions, newTestDistributionAction(fundingDestination, winners[winner].PayoutDestination, tc.quarks[i]))
+		}
+
+		err := intentHandler.ValidateDistribution(ctx, intentRecord, actions)
+		if tc.isValid {
+			require.NoError(t, err)
+		} else {
+			require.Error(t, err)
+		}
+	}
+}
+
+func testServer_Membership_PagedPoolsMatchGetPool(t *testing.T, accounts account.Store, pools pool.Store, profiles profile.Store) {
+	ctx := context.Background()
+	codeData := codedata.NewTestDataProvider()
+	eventBus := event.NewBus[*commonpb.UserId, *eventpb.Event]()
+	server := newTestServer(t, accounts, pools, profiles, codeData, eventBus, push.NewNoOpPusher())
+	codetestutil.SetupRandomSubsidizer(t, codeData)
+
+	creatorKey := model.MustGenerateKeyPair()
+	creatorID := model.MustGenerateUserID()
+	accounts.Bind(ctx, creatorID, creatorKey.Proto())
+	accounts.SetRegistrationFlag(ctx, creatorID, true)
+
+	betterKey := model.MustGenerateKeyPair()
+	betterID := model.MustGenerateUserID()
+	betterPayoutDestination := model.MustGenerateKeyPair().Proto()
+	accounts.Bind(ctx, betterID, betterKey.Proto())
+	accounts.SetRegistrationFlag(ctx, betterID, true)
+	setupPrimaryAccountOnCode(t, codeData, betterKey.Proto(), betterPayoutDestination)
+
+	var poolIDs []*poolpb.PoolId
+	for i := range 4 {
+		rendezvousKey := model.MustGenerateKeyPair()
+		poolID := pool.ToPoolID(rendezvousKey)
+		protoPool := generateNewProtoPool(poolID)
+		protoPool.Creator = creatorID
+
+		// Each of the creator's pool accounts requires a unique derivation index
+		require.NoError(t, codeData.CreateAccountInfo(ctx, &codeaccount.Record{
+			OwnerAccount:     base58.Encode(creatorKey.Public()),
+			AuthorityAccount: base58.Encode(model.MustGenerateKeyPair().Public()),
+			TokenAccount:     base58.Encode(protoPool.FundingDestination.Value),
+			MintAccount:      codecommon.CoreMintAccount.PublicKey().ToBase58(),
+			AccountType:      codecommonpb.AccountType_POOL,
+			Index:            uint64(i + 1),
+		}))
+
+		createPoolReq := &poolpb.CreatePoolRequest{
+			Pool: protoPool,
+		}
+		require.NoError(t, rendezvousKey.Sign(protoPool, &createPoolReq.RendezvousSignature))
+		require.NoError(t, creatorKey.Auth(createPoolReq, &createPoolReq.Auth))
+
+		createPoolResp, err := server.CreatePool(ctx, createPoolReq)
+		require.NoError(t, err)
+		require.Equal(t, poolpb.CreatePoolResponse_OK, createPoolResp.Result)
+
+		poolIDs = append(poolIDs, poolID)
+
+		// Leave one pool without any bets
+		if i == 0 {
+			continue
+		}
+
+		for _, betUserID := range []*commonpb.UserId{betterID, model.MustGenerateUserID()} {
+			bet := generateNewProtoBet(i%2 == 0)
+			bet.UserId = betUserID
+			bettingKey := betterKey
+			if bytes.Equal(betUserID.Value, betterID.Value) {
+				bet.PayoutDestination = betterPayoutDestination
+			} else {
+				bettingKey = model.MustGenerateKeyPair()
+				accounts.Bind(ctx, betUserID, bettingKey.Proto())
+				accounts.SetRegistrationFlag(ctx, betUserID, true)
+				setupPrimaryAccountOnCode(t, codeData, bettingKey.Proto(), bet.PayoutDestination)
+			}
+
+			makeBetReq := &poolpb.MakeBetRequest{
+				PoolId: poolID,
+				Bet:    bet,
+			}
+			require.NoError(t, rendezvousKey.Sign(bet, &makeBetReq.RendezvousSignature))
+			require.NoError(t, bettingKey.Auth(makeBetReq, &makeBetReq.Auth))
+
+			makeBetResp, err := server.MakeBet(ctx, makeBetReq)
+			require.NoError(t, err)
+			require.Equal(t, poolpb.MakeBetResponse_OK, makeBetResp.Result)
+
+			// Leave one bet unpaid
+			if i != 1 {
+				simulateBetPayment(t, codeData, pools, protoPool, bet)
+			}
+		}
+
+		// Resolve one pool, so user summaries are populated
+		if i == 3 {
+			require.NoError(t, pools.ClosePool(ctx, poolID, time.Now(), createPoolReq.RendezvousSignature))
+			require.NoError(t, pools.ResolvePool(ctx, poolID, pool.ResolutionNo, createPoolReq.RendezvousSignature))
+		}
+	}
+
+	for _, tc := range []struct {
+		keyPair          model.KeyPair
+		expectedNumPools int
+	}{
+		{creatorKey, len(poolIDs)},
+		{betterKey, len(poolIDs) - 1},
+	} {
+		keyPair := tc.keyPair
+
+		getPagedReq := &poolpb.GetPagedPoolsRequest{}
+		require.NoError(t, keyPair.Auth(getPagedReq, &getPagedReq.Auth))
+
+		getPagedResp, err := server.GetPagedPools(ctx, getPagedReq)
+		require.NoError(t, err)
+		require.Equal(t, poolpb.GetPagedPoolsResponse_OK, getPagedResp.Result)
+		require.Len(t, getPagedResp.Pools, tc.expectedNumPools)
+
+		for _, actual := range getPagedResp.Pools {
+			getPoolReq := &poolpb.GetPoolRequest{
+				Id:          actual.VerifiedMetadata.Id,
+				ExcludeBets: true,
+			}
+			require.NoError(t, keyPair.Auth(getPoolReq, &getPoolReq.Auth))
+
+			getPoolResp, err := server.GetPool(ctx, getPoolReq)
+			require.NoError(t, err)
+			require.Equal(t, poolpb.GetPoolResponse_OK, getPoolResp.Result)
+			require.NoError(t, protoutil.ProtoEqualError(getPoolResp.Pool, actual))
+		}
+	}
+}
+
+// newTestServer creates a pool server with the default buy in policy, which
+// forwards events to the provided bus
+func newTestServer(t *testing.T, accounts account.Store, pools pool.Store, profiles profile.Store, codeData codedata.Provider, eventBus *event.Bus[*commonpb.UserId, *eventpb.Event], pusher push.Pusher) *pool.Server {
+	buyInPolicy := pool.NewBuyInPolicy(accounts, codeData, pool.DefaultBuyInPolicyConfig)
+	return newTestServerWithBuyInPolicy(t, accounts, pools, profiles, codeData, buyInPolicy, eventBus, pusher)
+}
+
+func newTestServerWithBuyInPolicy(t *testing.T, accounts account.Store, pools pool.Store, profiles profile.Store, codeData codedata.Provider, buyInPolicy *pool.BuyInPolicy, eventBus *event.Bus[*commonpb.UserId, *eventpb.Event], pusher push.Pusher) *pool.Server {
+	log := zaptest.NewLogger(t)
+	authz := account.NewAuthorizer(log, accounts, auth.NewKeyPairAuthenticator())
+	return pool.NewServer(log, authz, accounts, pools, profiles, codeData, buyInPolicy, event.NewTestForwarder(eventBus), pusher)
+}
+
 func generateNewProtoPool(id *poolpb.PoolId) *poolpb.SignedPoolMetadata {
 	return &poolpb.SignedPoolMetadata{
 		Id:      id,
@@ -468,12 +870,21 @@ func setupPrimaryAccountOnCode(t *testing.T, codeData codedata.Provider, ownerAc
 	require.NoError(t, codeData.CreateAccountInfo(context.Background(), accountInfoRecord))
 }
 
-func simulateBetPayment(t *testing.T, codeData codedata.Provider, pool *poolpb.SignedPoolMetadata, bet *poolpb.SignedBetMetadata) {
+func simulateBetPayment(t *testing.T, codeData codedata.Provider, pools pool.Store, bettingPool *poolpb.SignedPoolMetadata, bet *poolpb.SignedBetMetadata) {
+	saveBetPaymentIntent(t, codeData, bettingPool, bet.BetId)
+
+	// Mirrors the successful bet payment callback from code-server
+	require.NoError(t, pools.MarkBetAsPaid(context.Background(), bet.BetId))
+}
+
+// saveBetPaymentIntent saves the code-server intent paying for a bet, without
+// marking the bet as paid
+func saveBetPaymentIntent(t *testing.T, codeData codedata.Provider, bettingPool *poolpb.SignedPoolMetadata, betID *poolpb.BetId) {
 	intentRecord := &codeintent.Record{
-		IntentId:   base58.Encode(bet.BetId.Value),
+		IntentId:   base58.Encode(betID.Value),
 		IntentType: codeintent.SendPublicPayment,
 		SendPublicPaymentMetadata: &codeintent.SendPublicPaymentMetadata{
-			DestinationTokenAccount: base58.Encode(pool.FundingDestination.Value),
+			DestinationTokenAccount: base58.Encode(bettingPool.FundingDestination.Value),
 			ExchangeCurrency:        "usd",
 			NativeAmount:            250.00,
 			ExchangeRate:            1.0,
@@ -485,3 +896,87 @@ func simulateBetPayment(t *testing.T, codeData codedata.Provider, pool *poolpb.S
 	}
 	require.NoError(t, codeData.SaveIntent(context.Background(), intentRecord))
 }
+
+// setupFundedPoolVaultOnCode sets up a Code-managed vault that's been funded
+// with the provided quarks by an external deposit
+func setupFundedPoolVaultOnCode(t *testing.T, codeData codedata.Provider, quarks uint64) *codecommon.Account {
+	timelockAccounts, err := codetestutil.NewRandomAccount(t).GetTimelockAccounts(codetestutil.NewRandomVmConfig(t, true))
+	require.NoError(t, err)
+
+	timelockRecord := timelockAccounts.ToDBRecord()
+	timelockRecord.VaultState = codetimelock.StateLocked
+	timelockRecord.Block += 1
+	require.NoError(t, codeData.SaveTimelock(context.Background(), timelockRecord))
+
+	depositRecord := &codedeposit.Record{
+		Signature:         base58.Encode(model.MustGenerateKeyPair().Public()),
+		Destination:       timelockAccounts.Vault.PublicKey().ToBase58(),
+		Amount:            quarks,
+		UsdMarketValue:    1.0,
+		Slot:              12345,
+		ConfirmationState: codetransaction.ConfirmationFinalized,
+		CreatedAt:         time.Now(),
+	}
+	require.NoError(t, codeData.SaveExternalDeposit(context.Background(), depositRecord))
+
+	return timelockAccounts.Vault
+}
+
+func newTestDistributionAction(source *codecommon.Account, destination *commonpb.PublicKey, quarks uint64) *codetransactionpb.Action {
+	return &codetransactionpb.Action{
+		Type: &codetransactionpb.Action_NoPrivacyTransfer{
+			NoPrivacyTransfer: &codetransactionpb.NoPrivacyTransferAction{
+				Source:      source.ToProto(),
+				Destination: &codecommonpb.SolanaAccountId{Value: destination.Value},
+				Amount:      quarks,
+			},
+		},
+	}
+}
+
+// testStaffAccountStore marks a set of users as staff
+type testStaffAccountStore struct {
+	account.Store
+
+	staff map[string]struct{}
+}
+
+func (s *testStaffAccountStore) IsStaff(_ context.Context, userID *commonpb.UserId) (bool, error) {
+	_, ok := s.staff[string(userID.Value)]
+	return ok, nil
+}
+
+type testPush struct {
+	title string
+	body  string
+}
+
+// testPusher records pushes sent to each user
+type testPusher struct {
+	mu           sync.Mutex
+	pushesByUser map[string][]*testPush
+}
+
+func newTestPusher() *testPusher {
+	return &testPusher{
+		pushesByUser: make(map[string][]*testPush),
+	}
+}
+
+func (p *testPusher) SendBasicPushes(_ context.Context, title, body string, users ...*commonpb.UserId) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, userID := range users {
+		key := model.UserIDString(userID)
+		p.pushesByUser[key] = append(p.pushesByUser[key], &testPush{title: title, body: body})
+	}
+	return nil
+}
+
+func (p *testPusher) getPushesTo(userID *commonpb.UserId) []*testPush {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]*testPush(nil), p.pushesByUser[model.UserIDString(userID)]...)
+}
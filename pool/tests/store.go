@@ -23,6 +23,10 @@ func RunStoreTests(t *testing.T, s pool.Store, teardown func()) {
 		testPoolStore_PoolHappyPath,
 		testPoolStore_BetHappyPath,
 		testPoolStore_MemberHappyPath,
+		testPoolStore_RefundHappyPath,
+		testPoolStore_PaidBetCountsHappyPath,
+		testPoolStore_BatchHappyPath,
+		testPoolStore_UnpaidBetsHappyPath,
 	} {
 		tf(t, s)
 		teardown()
@@ -300,6 +304,407 @@ func testPoolStore_MemberHappyPath(t *testing.T, s pool.Store) {
 	}
 }
 
+func testPoolStore_RefundHappyPath(t *testing.T, s pool.Store) {
+	ctx := context.Background()
+
+	now := time.Now().UTC().Truncate(time.Second)
+
+	_, err := s.GetUnresolvedPoolsClosedBefore(ctx, now, 10)
+	require.Equal(t, pool.ErrPoolNotFound, err)
+
+	var expected []*pool.Pool
+	for i := 0; i < 5; i++ {
+		closedAt := now.Add(time.Duration(i-3) * time.Hour)
+
+		p := &pool.Pool{
+			ID:                 pool.ToPoolID(model.MustGenerateKeyPair()),
+			CreatorID:          model.MustGenerateUserID(),
+			Name:               "Will it snow today?",
+			BuyInCurrency:      "usd",
+			BuyInAmount:        5.00,
+			FundingDestination: model.MustGenerateKeyPair().Proto(),
+			IsOpen:             false,
+			Resolution:         pool.ResolutionUnknown,
+			CreatedAt:          now.Add(-24 * time.Hour),
+			ClosedAt:           &closedAt,
+			Signature:          &commonpb.Signature{Value: make([]byte, 64)},
+		}
+		rand.Read(p.Signature.Value[:])
+		require.NoError(t, s.CreatePool(ctx, p))
+
+		expected = append(expected, p)
+	}
+
+	open := expected[0].Clone()
+	open.ID = pool.ToPoolID(model.MustGenerateKeyPair())
+	open.FundingDestination = model.MustGenerateKeyPair().Proto()
+	open.IsOpen = true
+	open.ClosedAt = nil
+	require.NoError(t, s.CreatePool(ctx, open))
+	require.Equal(t, pool.ErrPoolOpen, s.MarkRefundOwed(ctx, open.ID))
+
+	actual, err := s.GetUnresolvedPoolsClosedBefore(ctx, now.Add(-time.Hour), 10)
+	require.NoError(t, err)
+	require.Len(t, actual, 3)
+	for i, p := range actual {
+		assertEquivalentPools(t, expected[i], p)
+	}
+
+	actual, err = s.GetUnresolvedPoolsClosedBefore(ctx, now.Add(-time.Hour), 2)
+	require.NoError(t, err)
+	require.Len(t, actual, 2)
+
+	require.NoError(t, s.MarkRefundOwed(ctx, expected[0].ID))
+	require.Equal(t, pool.ErrPoolRefundOwed, s.MarkRefundOwed(ctx, expected[0].ID))
+
+	newSignature := &commonpb.Signature{Value: make([]byte, 64)}
+	rand.Read(newSignature.Value[:])
+	require.NoError(t, s.ResolvePool(ctx, expected[1].ID, pool.ResolutionYes, newSignature))
+	require.Equal(t, pool.ErrPoolResolved, s.MarkRefundOwed(ctx, expected[1].ID))
+
+	require.Equal(t, pool.ErrPoolNotFound, s.MarkRefundOwed(ctx, pool.ToPoolID(model.MustGenerateKeyPair())))
+
+	actualPool, err := s.GetPoolByID(ctx, expected[0].ID)
+	require.NoError(t, err)
+	require.Equal(t, pool.ResolutionUnknown, actualPool.Resolution)
+	require.True(t, actualPool.IsRefundOwed)
+	require.NoError(t, protoutil.ProtoEqualError(expected[0].Signature, actualPool.Signature))
+
+	actualPool, err = s.GetPoolByID(ctx, expected[1].ID)
+	require.NoError(t, err)
+	require.Equal(t, pool.ResolutionYes, actualPool.Resolution)
+	require.False(t, actualPool.IsRefundOwed)
+
+	actual, err = s.GetUnresolvedPoolsClosedBefore(ctx, now.Add(-time.Hour), 10)
+	require.NoError(t, err)
+	require.Len(t, actual, 1)
+	assertEquivalentPools(t, expected[2], actual[0])
+
+	// The creator can still sign the refund for a pool that owes one
+	require.NoError(t, s.ResolvePool(ctx, expected[0].ID, pool.ResolutionRefunded, newSignature))
+
+	actualPool, err = s.GetPoolByID(ctx, expected[0].ID)
+	require.NoError(t, err)
+	require.Equal(t, pool.ResolutionRefunded, actualPool.Resolution)
+	require.NoError(t, protoutil.ProtoEqualError(newSignature, actualPool.Signature))
+}
+
+func testPoolStore_PaidBetCountsHappyPath(t *testing.T, s pool.Store) {
+	ctx := context.Background()
+
+	poolID := pool.ToPoolID(model.MustGenerateKeyPair())
+
+	_, err := s.RepairPaidBetCounts(ctx, poolID)
+	require.Equal(t, pool.ErrPoolNotFound, err)
+
+	_, err = s.GetUnresolvedPools(ctx, nil, 10)
+	require.Equal(t, pool.ErrPoolNotFound, err)
+
+	// Bets paid before the pool exists aren't counted until they're repaired
+	orphaned := &pool.Bet{
+		PoolID:            poolID,
+		ID:                pool.ToBetID(model.MustGenerateKeyPair()),
+		UserID:            model.MustGenerateUserID(),
+		SelectedOutcome:   true,
+		PayoutDestination: model.MustGenerateKeyPair().Proto(),
+		Ts:                time.Now().UTC().Truncate(time.Second),
+		Signature:         &commonpb.Signature{Value: make([]byte, 64)},
+	}
+	require.NoError(t, s.CreateBet(ctx, orphaned))
+	require.NoError(t, s.MarkBetAsPaid(ctx, orphaned.ID))
+
+	expected := &pool.Pool{
+		ID:                 poolID,
+		CreatorID:          model.MustGenerateUserID(),
+		Name:               "Will it rain tomorrow?",
+		BuyInCurrency:      "usd",
+		BuyInAmount:        5.00,
+		FundingDestination: model.MustGenerateKeyPair().Proto(),
+		IsOpen:             true,
+		CreatedAt:          time.Now().UTC().Truncate(time.Second),
+		Signature:          &commonpb.Signature{Value: make([]byte, 64)},
+	}
+	require.NoError(t, s.CreatePool(ctx, expected))
+
+	counts, err := s.GetPaidBetCounts(ctx, poolID)
+	require.NoError(t, err)
+	assertPaidBetCounts(t, []uint32{0, 0}, counts)
+
+	isRepaired, err := s.RepairPaidBetCounts(ctx, poolID)
+	require.NoError(t, err)
+	require.True(t, isRepaired)
+
+	counts, err = s.GetPaidBetCounts(ctx, poolID)
+	require.NoError(t, err)
+	assertPaidBetCounts(t, []uint32{1, 0}, counts)
+
+	isRepaired, err = s.RepairPaidBetCounts(ctx, poolID)
+	require.NoError(t, err)
+	require.False(t, isRepaired)
+
+	var bets []*pool.Bet
+	for i := range 4 {
+		bet := &pool.Bet{
+			PoolID:            poolID,
+			ID:                pool.ToBetID(model.MustGenerateKeyPair()),
+			UserID:            model.MustGenerateUserID(),
+			SelectedOutcome:   i%2 == 0,
+			PayoutDestination: model.MustGenerateKeyPair().Proto(),
+			Ts:                time.Now().UTC().Truncate(time.Second),
+			Signature:         &commonpb.Signature{Value: make([]byte, 64)},
+		}
+		require.NoError(t, s.CreateBet(ctx, bet))
+		bets = append(bets, bet)
+	}
+
+	counts, err = s.GetPaidBetCounts(ctx, poolID)
+	require.NoError(t, err)
+	assertPaidBetCounts(t, []uint32{1, 0}, counts)
+
+	for _, bet := range bets[:3] {
+		require.NoError(t, s.MarkBetAsPaid(ctx, bet.ID))
+		require.Equal(t, pool.ErrBetPaid, s.MarkBetAsPaid(ctx, bet.ID))
+	}
+
+	counts, err = s.GetPaidBetCounts(ctx, poolID)
+	require.NoError(t, err)
+	assertPaidBetCounts(t, []uint32{3, 1}, counts)
+
+	require.NoError(t, s.UpdateBetOutcome(ctx, bets[0].ID, false, bets[0].Signature, bets[0].Ts))
+	require.NoError(t, s.UpdateBetOutcome(ctx, bets[3].ID, true, bets[3].Signature, bets[3].Ts))
+
+	counts, err = s.GetPaidBetCounts(ctx, poolID)
+	require.NoError(t, err)
+	assertPaidBetCounts(t, []uint32{2, 2}, counts)
+
+	isRepaired, err = s.RepairPaidBetCounts(ctx, poolID)
+	require.NoError(t, err)
+	require.False(t, isRepaired)
+
+	var poolIDs []*poolpb.PoolId
+	for range 3 {
+		other := expected.Clone()
+		other.ID = pool.ToPoolID(model.MustGenerateKeyPair())
+		other.FundingDestination = model.MustGenerateKeyPair().Proto()
+		require.NoError(t, s.CreatePool(ctx, other))
+		poolIDs = append(poolIDs, other.ID)
+	}
+	require.NoError(t, s.ClosePool(ctx, poolIDs[0], time.Now(), expected.Signature))
+	require.NoError(t, s.ResolvePool(ctx, poolIDs[0], pool.ResolutionRefunded, expected.Signature))
+
+	var unresolved []*pool.Pool
+	var cursor *poolpb.PoolId
+	for {
+		page, err := s.GetUnresolvedPools(ctx, cursor, 2)
+		if err == pool.ErrPoolNotFound {
+			break
+		}
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(page), 2)
+
+		unresolved = append(unresolved, page...)
+		cursor = page[len(page)-1].ID
+	}
+	require.Len(t, unresolved, 3)
+	for i, actual := range unresolved {
+		require.False(t, actual.HasResolution())
+		require.False(t, bytes.Equal(poolIDs[0].Value, actual.ID.Value))
+		if i > 0 {
+			require.Less(t, pool.PoolIDString(unresolved[i-1].ID), pool.PoolIDString(actual.ID))
+		}
+	}
+}
+
+func testPoolStore_UnpaidBetsHappyPath(t *testing.T, s pool.Store) {
+	ctx := context.Background()
+
+	leaseDuration := 500 * time.Millisecond
+
+	_, err := s.ClaimUnpaidBetsOnUnresolvedPools(ctx, leaseDuration, 10)
+	require.Equal(t, pool.ErrBetNotFound, err)
+
+	var poolIDs []*poolpb.PoolId
+	for range 2 {
+		p := &pool.Pool{
+			ID:                 pool.ToPoolID(model.MustGenerateKeyPair()),
+			CreatorID:          model.MustGenerateUserID(),
+			Name:               "Will it rain today?",
+			BuyInCurrency:      "usd",
+			BuyInAmount:        5.00,
+			FundingDestination: model.MustGenerateKeyPair().Proto(),
+			IsOpen:             true,
+			CreatedAt:          time.Now().UTC().Truncate(time.Second),
+			Signature:          &commonpb.Signature{Value: make([]byte, 64)},
+		}
+		require.NoError(t, s.CreatePool(ctx, p))
+		poolIDs = append(poolIDs, p.ID)
+	}
+
+	var bets []*pool.Bet
+	for i := range 8 {
+		bet := &pool.Bet{
+			PoolID:            poolIDs[i%2],
+			ID:                pool.ToBetID(model.MustGenerateKeyPair()),
+			UserID:            model.MustGenerateUserID(),
+			SelectedOutcome:   true,
+			PayoutDestination: model.MustGenerateKeyPair().Proto(),
+			Ts:                time.Now().UTC().Truncate(time.Second),
+			Signature:         &commonpb.Signature{Value: make([]byte, 64)},
+		}
+		require.NoError(t, s.CreateBet(ctx, bet))
+		bets = append(bets, bet)
+	}
+
+	require.NoError(t, s.MarkBetAsPaid(ctx, bets[0].ID))
+	require.Equal(t, pool.ErrBetPaid, s.MarkBetAsPaid(ctx, bets[0].ID))
+	require.NoError(t, s.MarkBetAsPaid(ctx, bets[2].ID))
+
+	// Bets on the second pool are excluded once it's resolved
+	require.NoError(t, s.ClosePool(ctx, poolIDs[1], time.Now(), &commonpb.Signature{Value: make([]byte, 64)}))
+	require.NoError(t, s.ResolvePool(ctx, poolIDs[1], pool.ResolutionYes, &commonpb.Signature{Value: make([]byte, 64)}))
+
+	expected := []*pool.Bet{bets[4], bets[6]}
+
+	assertClaimed := func(actual []*pool.Bet) {
+		require.Len(t, actual, len(expected))
+		for i, bet := range actual {
+			require.False(t, bet.IsIntentSubmitted)
+			for _, other := range actual[:i] {
+				require.NotEqual(t, pool.BetIDString(other.ID), pool.BetIDString(bet.ID))
+			}
+
+			var found bool
+			for _, expectedBet := range expected {
+				if bytes.Equal(expectedBet.ID.Value, bet.ID.Value) {
+					assertEquivalentBets(t, expectedBet, bet)
+					found = true
+				}
+			}
+			require.True(t, found)
+		}
+	}
+
+	// Claimed bets are skipped until their lease expires
+	var actual []*pool.Bet
+	for {
+		claimed, err := s.ClaimUnpaidBetsOnUnresolvedPools(ctx, leaseDuration, 1)
+		if err == pool.ErrBetNotFound {
+			break
+		}
+		require.NoError(t, err)
+		require.Len(t, claimed, 1)
+
+		actual = append(actual, claimed...)
+	}
+	assertClaimed(actual)
+
+	_, err = s.ClaimUnpaidBetsOnUnresolvedPools(ctx, leaseDuration, 10)
+	require.Equal(t, pool.ErrBetNotFound, err)
+
+	time.Sleep(leaseDuration)
+
+	actual, err = s.ClaimUnpaidBetsOnUnresolvedPools(ctx, leaseDuration, 10)
+	require.NoError(t, err)
+	assertClaimed(actual)
+}
+
+func testPoolStore_BatchHappyPath(t *testing.T, s pool.Store) {
+	ctx := context.Background()
+
+	userID := model.MustGenerateUserID()
+
+	var poolIDs []*poolpb.PoolId
+	for range 3 {
+		poolIDs = append(poolIDs, pool.ToPoolID(model.MustGenerateKeyPair()))
+	}
+
+	_, err := s.GetPoolsByID(ctx, poolIDs)
+	require.Equal(t, pool.ErrPoolNotFound, err)
+
+	_, err = s.GetBetsByUserAndPools(ctx, userID, poolIDs)
+	require.Equal(t, pool.ErrBetNotFound, err)
+
+	paidBetCountsByPool, err := s.GetPaidBetCountsByPools(ctx, poolIDs)
+	require.NoError(t, err)
+	require.Empty(t, paidBetCountsByPool)
+
+	var expectedPools []*pool.Pool
+	var expectedBets []*pool.Bet
+	for i, poolID := range poolIDs[:2] {
+		expectedPool := &pool.Pool{
+			ID:                 poolID,
+			CreatorID:          model.MustGenerateUserID(),
+			Name:               "Will it rain today?",
+			BuyInCurrency:      "usd",
+			BuyInAmount:        10.00,
+			FundingDestination: model.MustGenerateKeyPair().Proto(),
+			IsOpen:             true,
+			CreatedAt:          time.Now().UTC().Truncate(time.Second),
+			Signature:          &commonpb.Signature{Value: make([]byte, 64)},
+		}
+		require.NoError(t, s.CreatePool(ctx, expectedPool))
+		expectedPools = append(expectedPools, expectedPool)
+
+		for _, betUserID := range []*commonpb.UserId{userID, model.MustGenerateUserID()} {
+			expectedBet := &pool.Bet{
+				PoolID:            poolID,
+				ID:                pool.ToBetID(model.MustGenerateKeyPair()),
+				UserID:            betUserID,
+				SelectedOutcome:   i == 0,
+				PayoutDestination: model.MustGenerateKeyPair().Proto(),
+				Ts:                time.Now().UTC().Truncate(time.Second),
+				Signature:         &commonpb.Signature{Value: make([]byte, 64)},
+			}
+			require.NoError(t, s.CreateBet(ctx, expectedBet))
+			require.NoError(t, s.MarkBetAsPaid(ctx, expectedBet.ID))
+			expectedBet.IsIntentSubmitted = true
+
+			if bytes.Equal(betUserID.Value, userID.Value) {
+				expectedBets = append(expectedBets, expectedBet)
+			}
+		}
+	}
+
+	actualPools, err := s.GetPoolsByID(ctx, poolIDs)
+	require.NoError(t, err)
+	require.Len(t, actualPools, len(expectedPools))
+	for _, expected := range expectedPools {
+		var found bool
+		for _, actual := range actualPools {
+			if bytes.Equal(expected.ID.Value, actual.ID.Value) {
+				assertEquivalentPools(t, expected, actual)
+				found = true
+			}
+		}
+		require.True(t, found)
+	}
+
+	actualBets, err := s.GetBetsByUserAndPools(ctx, userID, poolIDs)
+	require.NoError(t, err)
+	require.Len(t, actualBets, len(expectedBets))
+	for _, expected := range expectedBets {
+		var found bool
+		for _, actual := range actualBets {
+			if bytes.Equal(expected.ID.Value, actual.ID.Value) {
+				assertEquivalentBets(t, expected, actual)
+				found = true
+			}
+		}
+		require.True(t, found)
+	}
+
+	paidBetCountsByPool, err = s.GetPaidBetCountsByPools(ctx, poolIDs)
+	require.NoError(t, err)
+	require.Len(t, paidBetCountsByPool, 2)
+	assertPaidBetCounts(t, []uint32{2, 0}, paidBetCountsByPool[pool.PoolIDString(poolIDs[0])])
+	assertPaidBetCounts(t, []uint32{0, 2}, paidBetCountsByPool[pool.PoolIDString(poolIDs[1])])
+	for _, poolID := range poolIDs[:2] {
+		expected, err := s.GetPaidBetCounts(ctx, poolID)
+		require.NoError(t, err)
+		require.Equal(t, expected, paidBetCountsByPool[pool.PoolIDString(poolID)])
+	}
+}
+
 func assertEquivalentPools(t *testing.T, obj1, obj2 *pool.Pool) {
 	require.NoError(t, protoutil.ProtoEqualError(obj1.ID, obj2.ID))
 	require.NoError(t, protoutil.ProtoEqualError(obj1.CreatorID, obj2.CreatorID))
@@ -309,6 +714,7 @@ func assertEquivalentPools(t *testing.T, obj1, obj2 *pool.Pool) {
 	require.NoError(t, protoutil.ProtoEqualError(obj1.FundingDestination, obj2.FundingDestination))
 	require.Equal(t, obj1.IsOpen, obj2.IsOpen)
 	require.EqualValues(t, obj1.Resolution, obj2.Resolution)
+	require.Equal(t, obj1.IsRefundOwed, obj2.IsRefundOwed)
 	require.Equal(t, obj1.CreatedAt.UTC(), obj2.CreatedAt.UTC())
 	require.NoError(t, protoutil.ProtoEqualError(obj1.Signature, obj2.Signature))
 }
@@ -323,3 +729,10 @@ func assertEquivalentBets(t *testing.T, obj1, obj2 *pool.Bet) {
 	require.Equal(t, obj1.Ts.UTC(), obj2.Ts.UTC())
 	require.NoError(t, protoutil.ProtoEqualError(obj1.Signature, obj2.Signature))
 }
+
+func assertPaidBetCounts(t *testing.T, expected, actual []uint32) {
+	for len(actual) < len(expected) {
+		actual = append(actual, 0)
+	}
+	require.Equal(t, expected, actual)
+}
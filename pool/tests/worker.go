@@ -0,0 +1,259 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	commonpb "github.com/code-payments/flipcash-protobuf-api/generated/go/common/v1"
+	eventpb "github.com/code-payments/flipcash-protobuf-api/generated/go/event/v1"
+	poolpb "github.com/code-payments/flipcash-protobuf-api/generated/go/pool/v1"
+
+	codedata "github.com/code-payments/code-server/pkg/code/data"
+	"github.com/code-payments/flipcash-server/account"
+	"github.com/code-payments/flipcash-server/event"
+	"github.com/code-payments/flipcash-server/model"
+	"github.com/code-payments/flipcash-server/pool"
+	"github.com/code-payments/flipcash-server/profile"
+	"github.com/code-payments/flipcash-server/protoutil"
+)
+
+const (
+	testWorkerInterval = 10 * time.Millisecond
+)
+
+func RunWorkerTests(t *testing.T, accounts account.Store, pools pool.Store, profiles profile.Store, teardown func()) {
+	for _, tf := range []func(t *testing.T, accounts account.Store, pools pool.Store, profiles profile.Store){
+		testWorker_Refunder,
+		testWorker_Reconciler,
+		testWorker_Repairer,
+	} {
+		tf(t, accounts, pools, profiles)
+		teardown()
+	}
+}
+
+func testWorker_Refunder(t *testing.T, accounts account.Store, pools pool.Store, profiles profile.Store) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	log := zaptest.NewLogger(t)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	resolutionDeadline := time.Hour
+
+	expired, expiredKey := setupWorkerTestPool(t, pools)
+	closeWorkerTestPool(t, pools, expired, expiredKey, now.Add(-2*resolutionDeadline))
+	notExpired, notExpiredKey := setupWorkerTestPool(t, pools)
+	closeWorkerTestPool(t, pools, notExpired, notExpiredKey, now)
+	stillOpen, _ := setupWorkerTestPool(t, pools)
+
+	protoBet := generateNewProtoBet(true)
+	require.NoError(t, pools.CreateBet(ctx, pool.ToBetModel(expired.ID, protoBet, &commonpb.Signature{Value: make([]byte, 64)})))
+	require.NoError(t, pools.MarkBetAsPaid(ctx, protoBet.BetId))
+
+	// The first attempt fails, which the refunder retries on its next run
+	flakyPools := &testFlakyPoolStore{Store: pools, numFailures: 1}
+
+	pusher := newTestPusher()
+
+	refunder := pool.NewRefunder(log, flakyPools, pusher, resolutionDeadline)
+	go refunder.Start(ctx, testWorkerInterval)
+
+	require.Eventually(t, func() bool {
+		actual, err := pools.GetPoolByID(ctx, expired.ID)
+		require.NoError(t, err)
+		return actual.IsRefundOwed
+	}, time.Second, testWorkerInterval)
+
+	// The pool stays unresolved until the creator signs the refund
+	actual, err := pools.GetPoolByID(ctx, expired.ID)
+	require.NoError(t, err)
+	require.False(t, actual.HasResolution())
+	require.NoError(t, protoutil.ProtoEqualError(expired.Signature, actual.Signature))
+
+	// The creator is asked to refund bettors
+	require.Eventually(t, func() bool {
+		return len(pusher.getPushesTo(expired.CreatorID)) > 0
+	}, time.Second, testWorkerInterval)
+	pushes := pusher.getPushesTo(expired.CreatorID)
+	require.Len(t, pushes, 1)
+	require.Equal(t, "Pool Refund Required", pushes[0].title)
+	require.Contains(t, pushes[0].body, expired.Name)
+	require.Empty(t, pusher.getPushesTo(protoBet.UserId))
+
+	for _, unresolved := range []*pool.Pool{notExpired, stillOpen} {
+		actual, err := pools.GetPoolByID(ctx, unresolved.ID)
+		require.NoError(t, err)
+		require.False(t, actual.HasResolution())
+		require.False(t, actual.IsRefundOwed)
+		require.Empty(t, pusher.getPushesTo(unresolved.CreatorID))
+	}
+}
+
+func testWorker_Reconciler(t *testing.T, accounts account.Store, pools pool.Store, profiles profile.Store) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	log := zaptest.NewLogger(t)
+
+	codeData := codedata.NewTestDataProvider()
+	eventBus := event.NewBus[*commonpb.UserId, *eventpb.Event]()
+	eventObserver := event.NewTestEventObserver[*commonpb.UserId, *eventpb.Event]()
+	eventBus.AddHandler(eventObserver)
+
+	now := time.Now().UTC().Truncate(time.Second)
+
+	bettingPool, _ := setupWorkerTestPool(t, pools)
+	protoPool := bettingPool.ToProto().VerifiedMetadata
+
+	// Both bets with a payment intent are reconciled, no matter how long ago
+	// they were made. The last bet was never paid.
+	var bets []*pool.Bet
+	for _, ts := range []time.Time{now, now.Add(-48 * time.Hour), now} {
+		bet := pool.ToBetModel(bettingPool.ID, generateNewProtoBet(true), &commonpb.Signature{Value: make([]byte, 64)})
+		bet.Ts = ts
+		require.NoError(t, pools.CreateBet(ctx, bet))
+		bets = append(bets, bet)
+	}
+	saveBetPaymentIntent(t, codeData, protoPool, bets[0].ID)
+	saveBetPaymentIntent(t, codeData, protoPool, bets[1].ID)
+
+	reconciler := pool.NewBetPaymentReconciler(log, pools, codeData, event.NewTestForwarder(eventBus))
+	go reconciler.Start(ctx, testWorkerInterval)
+
+	isBettor := func(id *commonpb.UserId) bool { return bytes.Equal(bets[0].UserID.Value, id.Value) }
+	eventObserver.WaitFor(t, func(events []*event.KeyAndEvent[*commonpb.UserId, *eventpb.Event]) bool {
+		for _, keyAndEvent := range events {
+			if isBettor(keyAndEvent.Key) {
+				return true
+			}
+		}
+		return false
+	})
+	events := eventObserver.GetEvents(isBettor)
+	require.Len(t, events, 1)
+	betUpdate := events[0].Event.GetPoolBetUpdate()
+	require.NotNil(t, betUpdate)
+	require.NoError(t, protoutil.ProtoEqualError(bettingPool.ID, betUpdate.PoolId))
+	require.EqualValues(t, 2, betUpdate.BetSummary.GetBooleanSummary().NumYes)
+	require.EqualValues(t, 0, betUpdate.BetSummary.GetBooleanSummary().NumNo)
+
+	for _, paid := range bets[:2] {
+		actual, err := pools.GetBetByID(ctx, paid.ID)
+		require.NoError(t, err)
+		require.True(t, actual.IsIntentSubmitted)
+	}
+
+	actual, err := pools.GetBetByID(ctx, bets[2].ID)
+	require.NoError(t, err)
+	require.False(t, actual.IsIntentSubmitted)
+
+	counts, err := pools.GetPaidBetCounts(ctx, bettingPool.ID)
+	require.NoError(t, err)
+	assertPaidBetCounts(t, []uint32{2, 0}, counts)
+}
+
+func testWorker_Repairer(t *testing.T, accounts account.Store, pools pool.Store, profiles profile.Store) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	log := zaptest.NewLogger(t)
+
+	// Bets paid before their pool exists aren't counted, which drifts the paid
+	// bet counts. Only the unresolved pool is repaired.
+	var drifted []*pool.Pool
+	for range 2 {
+		rendezvousKey := model.MustGenerateKeyPair()
+		poolID := pool.ToPoolID(rendezvousKey)
+
+		bet := pool.ToBetModel(poolID, generateNewProtoBet(false), &commonpb.Signature{Value: make([]byte, 64)})
+		require.NoError(t, pools.CreateBet(ctx, bet))
+		require.NoError(t, pools.MarkBetAsPaid(ctx, bet.ID))
+
+		protoPool := generateNewProtoPool(poolID)
+		var signature *commonpb.Signature
+		require.NoError(t, rendezvousKey.Sign(protoPool, &signature))
+		created := pool.ToPoolModel(protoPool, signature)
+		require.NoError(t, pools.CreatePool(ctx, created))
+
+		counts, err := pools.GetPaidBetCounts(ctx, poolID)
+		require.NoError(t, err)
+		assertPaidBetCounts(t, []uint32{0, 0}, counts)
+
+		drifted = append(drifted, created)
+	}
+	unresolved, resolved := drifted[0], drifted[1]
+	require.NoError(t, pools.ClosePool(ctx, resolved.ID, time.Now(), &commonpb.Signature{Value: make([]byte, 64)}))
+	require.NoError(t, pools.ResolvePool(ctx, resolved.ID, pool.ResolutionNo, &commonpb.Signature{Value: make([]byte, 64)}))
+
+	repairer := pool.NewBetSummaryRepairer(log, pools)
+	go repairer.Start(ctx, testWorkerInterval)
+
+	require.Eventually(t, func() bool {
+		counts, err := pools.GetPaidBetCounts(ctx, unresolved.ID)
+		require.NoError(t, err)
+		return len(counts) > int(pool.BooleanOutcomeNo) && counts[pool.BooleanOutcomeNo] == 1
+	}, time.Second, testWorkerInterval)
+
+	counts, err := pools.GetPaidBetCounts(ctx, unresolved.ID)
+	require.NoError(t, err)
+	assertPaidBetCounts(t, []uint32{0, 1}, counts)
+
+	// Give the repairer a few more runs before checking the resolved pool
+	time.Sleep(5 * testWorkerInterval)
+
+	counts, err = pools.GetPaidBetCounts(ctx, resolved.ID)
+	require.NoError(t, err)
+	assertPaidBetCounts(t, []uint32{0, 0}, counts)
+}
+
+// testFlakyPoolStore fails the first calls to get a pool's paid bet counts
+type testFlakyPoolStore struct {
+	pool.Store
+
+	mu          sync.Mutex
+	numFailures int
+}
+
+func (s *testFlakyPoolStore) GetPaidBetCounts(ctx context.Context, poolID *poolpb.PoolId) ([]uint32, error) {
+	s.mu.Lock()
+	if s.numFailures > 0 {
+		s.numFailures--
+		s.mu.Unlock()
+		return nil, errors.New("pool store failure")
+	}
+	s.mu.Unlock()
+
+	return s.Store.GetPaidBetCounts(ctx, poolID)
+}
+
+// setupWorkerTestPool creates an open pool directly in the store
+func setupWorkerTestPool(t *testing.T, pools pool.Store) (*pool.Pool, model.KeyPair) {
+	rendezvousKey := model.MustGenerateKeyPair()
+	protoPool := generateNewProtoPool(pool.ToPoolID(rendezvousKey))
+
+	var signature *commonpb.Signature
+	require.NoError(t, rendezvousKey.Sign(protoPool, &signature))
+
+	created := pool.ToPoolModel(protoPool, signature)
+	require.NoError(t, pools.CreatePool(context.Background(), created))
+
+	return created, rendezvousKey
+}
+
+// closeWorkerTestPool closes a pool created by setupWorkerTestPool, as signed by
+// the creator, at the provided time
+func closeWorkerTestPool(t *testing.T, pools pool.Store, toClose *pool.Pool, rendezvousKey model.KeyPair, closedAt time.Time) {
+	toClose.IsOpen = false
+	toClose.ClosedAt = &closedAt
+	protoPool := toClose.ToProto().VerifiedMetadata
+
+	var signature *commonpb.Signature
+	require.NoError(t, rendezvousKey.Sign(protoPool, &signature))
+	toClose.Signature = signature
+	require.NoError(t, pools.ClosePool(context.Background(), toClose.ID, closedAt, signature))
+}
@@ -1,93 +1,76 @@
 package pool
 
 import (
-	"bytes"
 	"context"
 	"errors"
 	"math"
 
 	commonpb "github.com/code-payments/flipcash-protobuf-api/generated/go/common/v1"
 	poolpb "github.com/code-payments/flipcash-protobuf-api/generated/go/pool/v1"
-
-	codedata "github.com/code-payments/code-server/pkg/code/data"
 )
 
-// todo: optimize when we don't require the entire bet list
-func GetBetSummary(ctx context.Context, pools Store, codeData codedata.Provider, pool *Pool) (*poolpb.BetSummary, []*Bet, error) {
-	bets, err := pools.GetBetsByPool(ctx, pool.ID)
-	if err != nil && err != ErrBetNotFound {
-		return nil, nil, err
+// GetBetSummary gets the bet summary for a pool from its paid bet counts
+func GetBetSummary(ctx context.Context, pools Store, pool *Pool) (*BetSummary, error) {
+	paidBetCounts, err := pools.GetPaidBetCounts(ctx, pool.ID)
+	if err != nil {
+		return nil, err
 	}
+	return newBetSummary(pool, paidBetCounts)
+}
 
-	var numYes, numNo int
-	for _, bet := range bets {
-		isPaid, err := bet.IsPaid(ctx, pools, codeData, pool)
-		if err != nil {
-			return nil, nil, err
-		}
-
-		if !isPaid {
+// newBetSummary builds a pool's bet summary from its paid bet counts
+func newBetSummary(pool *Pool, paidBetCounts []uint32) (*BetSummary, error) {
+	numBetsByOutcome := make([]uint32, NumBooleanOutcomes)
+	var numPaid int
+	for outcome, count := range paidBetCounts {
+		if count == 0 {
 			continue
 		}
-
-		if bet.SelectedOutcome {
-			numYes++
-		} else {
-			numNo++
+		if outcome >= len(numBetsByOutcome) {
+			return nil, errors.New("bet outcome out of range")
 		}
+		numBetsByOutcome[outcome] = count
+		numPaid += int(count)
 	}
 
-	return &poolpb.BetSummary{
-		Kind: &poolpb.BetSummary_BooleanSummary{
-			BooleanSummary: &poolpb.BetSummary_BooleanBetSummary{
-				NumYes: uint32(numYes),
-				NumNo:  uint32(numNo),
-			},
-		},
-		TotalAmountBet: &commonpb.FiatPaymentAmount{
-			Currency:     pool.BuyInCurrency,
-			NativeAmount: float64(numYes+numNo) * pool.BuyInAmount,
-		},
-	}, bets, nil
+	return &BetSummary{
+		Currency:         pool.BuyInCurrency,
+		NumBetsByOutcome: numBetsByOutcome,
+		TotalAmountBet:   float64(numPaid) * pool.BuyInAmount,
+	}, nil
 }
 
-func GetUserSummary(ctx context.Context, pools Store, codeData codedata.Provider, userID *commonpb.UserId, pool *Pool) (*poolpb.UserPoolSummary, error) {
-	res := &poolpb.UserPoolSummary{
-		Outcome: &poolpb.UserPoolSummary_None{},
-	}
-
-	if !pool.HasResolution() {
-		return res, nil
+func GetUserSummary(ctx context.Context, pools Store, userID *commonpb.UserId, pool *Pool) (*poolpb.UserPoolSummary, error) {
+	userBet, err := pools.GetBetByUser(ctx, pool.ID, userID)
+	if err == ErrBetNotFound {
+		return &poolpb.UserPoolSummary{
+			Outcome: &poolpb.UserPoolSummary_None{},
+		}, nil
+	} else if err != nil {
+		return nil, err
 	}
 
-	betSummary, bets, err := GetBetSummary(ctx, pools, codeData, pool)
+	betSummary, err := GetBetSummary(ctx, pools, pool)
 	if err != nil {
 		return nil, err
 	}
 
-	return getUserSummaryWithCachedBetMetadata(userID, pool, betSummary, bets)
+	return getUserSummaryForBet(pool, betSummary, userBet)
 }
 
 // Use this method when GetBetSummary has already been called to avoid recalculation
 //
 // todo: Export this utility?
-func getUserSummaryWithCachedBetMetadata(userID *commonpb.UserId, pool *Pool, betSummary *poolpb.BetSummary, bets []*Bet) (*poolpb.UserPoolSummary, error) {
+func getUserSummaryForBet(pool *Pool, betSummary *BetSummary, userBet *Bet) (*poolpb.UserPoolSummary, error) {
 	res := &poolpb.UserPoolSummary{
 		Outcome: &poolpb.UserPoolSummary_None{},
 	}
 
-	if !pool.HasResolution() {
+	if userBet == nil {
 		return res, nil
 	}
 
-	var userBet *Bet
-	for _, bet := range bets {
-		if bytes.Equal(bet.UserID.Value, userID.Value) {
-			userBet = bet
-			break
-		}
-	}
-	if userBet == nil {
+	if !pool.HasResolution() {
 		return res, nil
 	}
 
@@ -97,21 +80,16 @@ func getUserSummaryWithCachedBetMetadata(userID *commonpb.UserId, pool *Pool, be
 
 	var isUserWinner bool
 	var isUserRefunded bool
-	var numWinners, numLosers int
+	var numWinners int
 	switch pool.Resolution {
 	case ResolutionRefunded:
 		isUserWinner = false
 		isUserRefunded = true
-	case ResolutionYes:
-		isUserWinner = userBet.SelectedOutcome
-		isUserRefunded = betSummary.GetBooleanSummary().NumYes == 0
-		numWinners = int(betSummary.GetBooleanSummary().NumYes)
-		numLosers = int(betSummary.GetBooleanSummary().NumNo)
-	case ResolutionNo:
-		isUserWinner = !userBet.SelectedOutcome
-		isUserRefunded = betSummary.GetBooleanSummary().NumNo == 0
-		numWinners = int(betSummary.GetBooleanSummary().NumNo)
-		numLosers = int(betSummary.GetBooleanSummary().NumYes)
+	case ResolutionYes, ResolutionNo:
+		winningOutcome, _ := pool.WinningOutcome()
+		isUserWinner = userBet.Outcome() == winningOutcome
+		numWinners = betSummary.NumBetsForOutcome(winningOutcome)
+		isUserRefunded = numWinners == 0
 	default:
 		return nil, errors.New("unsupported resolution")
 	}
@@ -128,7 +106,7 @@ func getUserSummaryWithCachedBetMetadata(userID *commonpb.UserId, pool *Pool, be
 			},
 		}
 	} else if isUserWinner {
-		totalAmountReceived := (float64(numWinners+numLosers) * pool.BuyInAmount) / float64(numWinners)
+		totalAmountReceived := betSummary.TotalAmountBet / float64(numWinners)
 		amountWon := math.Max(totalAmountReceived-pool.BuyInAmount, 0)
 		res = &poolpb.UserPoolSummary{
 			Outcome: &poolpb.UserPoolSummary_Win{
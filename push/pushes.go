@@ -101,3 +101,12 @@ func SendTieBettingPoolPushes(ctx context.Context, pusher Pusher, poolName strin
 	)
 	return pusher.SendBasicPushes(ctx, title, body, participants...)
 }
+
+func SendRefundOwedBettingPoolPush(ctx context.Context, pusher Pusher, poolName string, creator *commonpb.UserId) error {
+	title := "Pool Refund Required"
+	body := fmt.Sprintf(
+		`'%s' wasn't resolved in time. Return everyone's buy in.`,
+		poolName,
+	)
+	return pusher.SendBasicPushes(ctx, title, body, creator)
+}